@@ -0,0 +1,37 @@
+package clock
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFakeClockSetAndAdvance(t *testing.T) {
+	start := time.Date(2026, 1, 15, 0, 0, 0, 0, time.UTC)
+	fc := NewFakeClock(start)
+
+	if got := fc.Now(); !got.Equal(start) {
+		t.Errorf("expected Now() to return %v, got %v", start, got)
+	}
+
+	fc.Advance(24 * time.Hour)
+	want := start.Add(24 * time.Hour)
+	if got := fc.Now(); !got.Equal(want) {
+		t.Errorf("expected Now() after Advance to return %v, got %v", want, got)
+	}
+
+	later := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	fc.Set(later)
+	if got := fc.Now(); !got.Equal(later) {
+		t.Errorf("expected Now() after Set to return %v, got %v", later, got)
+	}
+}
+
+func TestRealClockReturnsCurrentTime(t *testing.T) {
+	before := time.Now()
+	got := RealClock{}.Now()
+	after := time.Now()
+
+	if got.Before(before) || got.After(after) {
+		t.Errorf("expected RealClock.Now() to be between %v and %v, got %v", before, after, got)
+	}
+}
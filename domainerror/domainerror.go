@@ -0,0 +1,147 @@
+// Package domainerror is the typed error taxonomy shared by the sales,
+// stock, and general-ledger paths. Each member wraps an optional underlying
+// error (errors.Unwrap still reaches it) and carries enough structure --
+// Code, HTTPStatus, Fields -- for a caller to branch on the failure or
+// translate it into a REST response via ErrorToHTTP, instead of pattern
+// matching an fmt.Errorf string.
+package domainerror
+
+import "errors"
+
+// Domain error codes, one per taxonomy member. These are stable across
+// releases, unlike HTTPStatus which a handler may remap per endpoint.
+const (
+	CodeValidation       = 1
+	CodeNotFound         = 2
+	CodeConflict         = 3
+	CodePermission       = 4
+	CodeStockUnavailable = 5
+	CodeGLBalance        = 6
+)
+
+// DomainError is implemented by every typed error in this taxonomy, so
+// callers can branch on Code/HTTPStatus/Fields with a single errors.As
+// instead of a type switch over every concrete type.
+type DomainError interface {
+	error
+	Code() int
+	HTTPStatus() int
+	Unwrap() error
+	Fields() map[string]any
+}
+
+// ValidationError reports that a document failed a business rule check,
+// e.g. a percentage allocation that doesn't sum to 100%, or an account that
+// doesn't belong to the expected company. StatusCode lets the caller choose
+// the HTTP status per violation (400 for a bad field, 409 for a duplicate,
+// 403 for a blocked action) rather than always answering 400.
+type ValidationError struct {
+	Message    string
+	StatusCode int
+	Err        error
+	Extra      map[string]any
+}
+
+func (e *ValidationError) Error() string { return e.Message }
+func (e *ValidationError) Unwrap() error { return e.Err }
+func (e *ValidationError) Code() int     { return CodeValidation }
+func (e *ValidationError) HTTPStatus() int {
+	if e.StatusCode != 0 {
+		return e.StatusCode
+	}
+	return 400
+}
+func (e *ValidationError) Fields() map[string]any { return e.Extra }
+
+// NotFoundError reports that a referenced document or row doesn't exist.
+type NotFoundError struct {
+	Message string
+	Err     error
+	Extra   map[string]any
+}
+
+func (e *NotFoundError) Error() string          { return e.Message }
+func (e *NotFoundError) Unwrap() error          { return e.Err }
+func (e *NotFoundError) Code() int              { return CodeNotFound }
+func (e *NotFoundError) HTTPStatus() int        { return 404 }
+func (e *NotFoundError) Fields() map[string]any { return e.Extra }
+
+// ConflictError reports that an operation collides with the document's
+// current state, e.g. a mode of payment already linked to the company, or a
+// month's committed+reserved allocation exceeding its budget share.
+type ConflictError struct {
+	Message string
+	Err     error
+	Extra   map[string]any
+}
+
+func (e *ConflictError) Error() string          { return e.Message }
+func (e *ConflictError) Unwrap() error          { return e.Err }
+func (e *ConflictError) Code() int              { return CodeConflict }
+func (e *ConflictError) HTTPStatus() int        { return 409 }
+func (e *ConflictError) Fields() map[string]any { return e.Extra }
+
+// PermissionError reports that the caller isn't allowed to perform the
+// requested action, e.g. disabling a mode of payment still referenced by an
+// active POS profile.
+type PermissionError struct {
+	Message string
+	Err     error
+	Extra   map[string]any
+}
+
+func (e *PermissionError) Error() string          { return e.Message }
+func (e *PermissionError) Unwrap() error          { return e.Err }
+func (e *PermissionError) Code() int              { return CodePermission }
+func (e *PermissionError) HTTPStatus() int        { return 403 }
+func (e *PermissionError) Fields() map[string]any { return e.Extra }
+
+// StockUnavailableError reports that a stock-ledger write couldn't be
+// satisfied, e.g. a sales invoice shipping more of an item than its
+// warehouse bin has on hand.
+type StockUnavailableError struct {
+	Message string
+	Err     error
+	Extra   map[string]any
+}
+
+func (e *StockUnavailableError) Error() string          { return e.Message }
+func (e *StockUnavailableError) Unwrap() error          { return e.Err }
+func (e *StockUnavailableError) Code() int              { return CodeStockUnavailable }
+func (e *StockUnavailableError) HTTPStatus() int        { return 409 }
+func (e *StockUnavailableError) Fields() map[string]any { return e.Extra }
+
+// GLBalanceError reports that a general ledger posting couldn't be made,
+// e.g. the debit/credit side of a sales invoice's GL entries failed to
+// write as a unit.
+type GLBalanceError struct {
+	Message string
+	Err     error
+	Extra   map[string]any
+}
+
+func (e *GLBalanceError) Error() string          { return e.Message }
+func (e *GLBalanceError) Unwrap() error          { return e.Err }
+func (e *GLBalanceError) Code() int              { return CodeGLBalance }
+func (e *GLBalanceError) HTTPStatus() int        { return 422 }
+func (e *GLBalanceError) Fields() map[string]any { return e.Extra }
+
+// jsonBody is what ErrorToHTTP serializes for a REST handler to write as
+// the response body.
+type jsonBody struct {
+	Error  string         `json:"error"`
+	Code   int            `json:"code"`
+	Fields map[string]any `json:"fields,omitempty"`
+}
+
+// ErrorToHTTP maps err to the HTTP status and JSON body a REST handler
+// should write. Errors that don't implement DomainError fall back to 500
+// with a generic message, so an unexpected internal error never leaks an
+// unstructured wrapping chain to a client.
+func ErrorToHTTP(err error) (int, jsonBody) {
+	var de DomainError
+	if errors.As(err, &de) {
+		return de.HTTPStatus(), jsonBody{Error: de.Error(), Code: de.Code(), Fields: de.Fields()}
+	}
+	return 500, jsonBody{Error: "internal server error", Code: 0}
+}
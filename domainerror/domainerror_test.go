@@ -0,0 +1,85 @@
+package domainerror
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestValidationErrorHTTPStatusDefaultsAndOverrides(t *testing.T) {
+	bare := &ValidationError{Message: "bad field"}
+	if got := bare.HTTPStatus(); got != 400 {
+		t.Errorf("expected default HTTPStatus 400, got %d", got)
+	}
+
+	withStatus := &ValidationError{Message: "duplicate", StatusCode: 409}
+	if got := withStatus.HTTPStatus(); got != 409 {
+		t.Errorf("expected overridden HTTPStatus 409, got %d", got)
+	}
+	if got := withStatus.Code(); got != CodeValidation {
+		t.Errorf("expected Code %d, got %d", CodeValidation, got)
+	}
+}
+
+func TestEachTaxonomyMemberUnwrapsAndSatisfiesDomainError(t *testing.T) {
+	cause := errors.New("db exploded")
+
+	members := []DomainError{
+		&ValidationError{Message: "v", Err: cause},
+		&NotFoundError{Message: "nf", Err: cause},
+		&ConflictError{Message: "c", Err: cause},
+		&PermissionError{Message: "p", Err: cause},
+		&StockUnavailableError{Message: "su", Err: cause},
+		&GLBalanceError{Message: "gl", Err: cause},
+	}
+
+	for _, m := range members {
+		if !errors.Is(m, cause) {
+			t.Errorf("%T: expected errors.Is to reach the wrapped cause", m)
+		}
+		if m.HTTPStatus() < 400 {
+			t.Errorf("%T: expected a 4xx/5xx HTTPStatus, got %d", m, m.HTTPStatus())
+		}
+	}
+}
+
+func TestErrorToHTTPMapsDomainErrorsAndFallsBackOnOthers(t *testing.T) {
+	status, body := ErrorToHTTP(&NotFoundError{Message: "no such bin"})
+	if status != 404 {
+		t.Errorf("expected 404, got %d", status)
+	}
+	if body.Error != "no such bin" || body.Code != CodeNotFound {
+		t.Errorf("unexpected body: %+v", body)
+	}
+
+	status, body = ErrorToHTTP(errors.New("boom"))
+	if status != 500 {
+		t.Errorf("expected 500 for a non-domain error, got %d", status)
+	}
+	if body.Code != 0 {
+		t.Errorf("expected code 0 for a non-domain error, got %d", body.Code)
+	}
+}
+
+func TestErrorToHTTPUnwrapsToFindADomainError(t *testing.T) {
+	wrapped := errors.New("outer context")
+	inner := &ConflictError{Message: "already linked"}
+	_ = wrapped
+
+	status, body := ErrorToHTTP(&wrapErr{msg: "outer", err: inner})
+	if status != 409 {
+		t.Errorf("expected 409 from the wrapped ConflictError, got %d", status)
+	}
+	if body.Code != CodeConflict {
+		t.Errorf("expected code %d, got %d", CodeConflict, body.Code)
+	}
+}
+
+// wrapErr is a minimal %w-style wrapper used to confirm ErrorToHTTP finds a
+// DomainError through an intermediate wrapping layer.
+type wrapErr struct {
+	msg string
+	err error
+}
+
+func (e *wrapErr) Error() string { return e.msg + ": " + e.err.Error() }
+func (e *wrapErr) Unwrap() error { return e.err }
@@ -2,29 +2,44 @@ package main
 
 import (
 	"context"
+	"database/sql"
 	"fmt"
-	"time"
 
 	"github.com/google/uuid"
+
+	"github.com/GughanS/erpnext-ast-analyzer/storage"
 )
 
 func main() {
 	fmt.Println("🚀 Starting Migration Parity Test...")
 
+	// 0. Wire up the Postgres-backed store (driver registered via its
+	// package's blank import in production; omitted here since this is a
+	// standalone smoke test).
+	db, err := sql.Open("postgres", "postgres://localhost/erpnext?sslmode=disable")
+	if err != nil {
+		fmt.Printf("❌ Error opening store: %v\n", err)
+		return
+	}
+	defer db.Close()
+	store := storage.NewPostgresStore(db)
+
 	// 1. Create a UUID for the invoice
 	id := uuid.New()
 
-	// 2. Create the Invoice (matching your generated struct fields exactly)
+	// 2. Create the Invoice (matching your generated struct fields exactly).
+	// PostingDate is left zero here; OnSubmit stamps it from the
+	// SalesInvoiceService's clock before posting GL/stock entries.
 	invoice := SalesInvoice{
-		ID:          id,
-		Item:        "Consulting Service",
-		Company:     "PearlThoughts Inc",
-		Customer:    "Client X",
-		DebitTo:     "Accounts Receivable",
-		PostingDate: time.Now(),
-		Rate:        100.0,
-		Qty:         10.0,
-		Submitted:   false,
+		ID:        id,
+		Item:      "Consulting Service",
+		Company:   "PearlThoughts Inc",
+		Customer:  "Client X",
+		DebitTo:   "Accounts Receivable",
+		Rate:      100.0,
+		Qty:       10.0,
+		Submitted: false,
+		Store:     store,
 	}
 
 	fmt.Printf("📝 Created Invoice: %s (Customer: %s)\n", invoice.ID, invoice.Customer)
@@ -34,7 +49,7 @@ func main() {
 
 	// 4. Trigger the Logic
 	fmt.Println("\n--- Executing OnSubmit Logic ---")
-	err := invoice.OnSubmit(ctx)
+	err = invoice.OnSubmit(ctx)
 
 	// 5. Verify Results
 	if err != nil {
@@ -4,10 +4,15 @@ package main
 
 import (
         "context"
+        "database/sql"
         "fmt"
         "time"
 
         "github.com/google/uuid"
+
+        "github.com/GughanS/erpnext-ast-analyzer/clock"
+        "github.com/GughanS/erpnext-ast-analyzer/domainerror"
+        "github.com/GughanS/erpnext-ast-analyzer/storage"
 )
 
 // SalesInvoice represents a sales invoice.
@@ -24,92 +29,337 @@ type SalesInvoice struct {
         PriceListRate    float64   `json:"price_list_rate"`
         Qty              float64   `json:"qty"`
         Submitted       bool       `json:"submitted"`
+
+        // Store backs this invoice's submission with real persistence. It
+        // must be set (see NewSalesInvoiceService) before OnSubmit is called.
+        Store storage.Store `json:"-"`
+
+        // Trace records the name of each submission state as it completes,
+        // in order (e.g. ["Validate", "UpdateInvoice", "PostGL", "PostStock",
+        // "Submitted"]), so a caller can assert the exact path OnSubmit took.
+        Trace []string `json:"-"`
+
+        // tx is the GL/stock ledger transaction for the in-flight
+        // submission, set by SubmissionExecutor.Run. PostGL and PostStock
+        // post against it.
+        tx *sql.Tx
+
+        // nextState is the state Run starts from when it is non-nil (Run
+        // starts from Validate otherwise). It is always cleared back to nil
+        // before Run returns, including on
+        // cancellation: a canceled run's transaction is rolled back (see
+        // SubmissionExecutor.Run), which undoes any PostGL/PostStock work it
+        // had done, so a later OnSubmit always restarts from Validate rather
+        // than resuming mid-transaction and risking a double post.
+        nextState StateFn
+
+        // VoucherNo and RunningBalance are populated by
+        // GeneralLedgerService.MakeGLEntries from the post_gl_entries
+        // stored procedure's output parameters.
+        VoucherNo      string  `json:"voucher_no"`
+        RunningBalance float64 `json:"running_balance"`
 }
 
-// OnSubmit updates the sales invoice and makes general ledger entries.
-func (si *SalesInvoice) OnSubmit(ctx context.Context) error {
-        // Update sales invoice
-        if err := si.updateSalesInvoice(ctx); err != nil {
-                return fmt.Errorf("failed to update sales invoice: %w", err)
+// recordState appends name to si.Trace. Each StateFn calls this itself,
+// rather than the executor inferring a name from the function value, so the
+// trace records exactly the states that ran, in order.
+func (si *SalesInvoice) recordState(name string) {
+        si.Trace = append(si.Trace, name)
+}
+
+// StateFn is one step of the SalesInvoice submission state machine. It does
+// the work for the current state and returns the next StateFn to run, or
+// (nil, nil) to signal that submission is complete, or a non-nil error to
+// abort it.
+type StateFn func(ctx context.Context, si *SalesInvoice) (StateFn, error)
+
+// Option configures a SubmissionExecutor.
+type Option func(*SubmissionExecutor)
+
+// Reset registers fn to run when a state returns an error, so the
+// executor's caller can undo whatever the failed run committed (e.g. roll
+// back the GL/stock ledger transaction).
+func Reset(fn func(ctx context.Context, si *SalesInvoice, tx *sql.Tx)) Option {
+        return func(e *SubmissionExecutor) { e.reset = fn }
+}
+
+// LogFacility registers fn to receive the name of each state as it
+// completes, for observability hooks that would rather not inspect
+// si.Trace directly.
+func LogFacility(fn func(string)) Option {
+        return func(e *SubmissionExecutor) { e.log = fn }
+}
+
+// SubmissionExecutor drives a SalesInvoice through its submission states --
+// Validate -> UpdateInvoice -> PostGL -> PostStock -> Submitted (the
+// invoice's implicit starting state, Draft, never runs as a StateFn) --
+// looping until a StateFn reports completion or failure.
+//
+// Run is reentrant: a canceled run rolls back its transaction (through
+// Reset's fn when one is registered, otherwise by calling tx.Rollback
+// directly) before returning, so it never leaves an
+// abandoned *sql.Tx open. Because that rollback undoes any PostGL/PostStock
+// work the canceled run had done, si.nextState is cleared rather than
+// pointed at the interrupted state -- a later OnSubmit call always resumes
+// by restarting the whole state machine from Validate. Validate and
+// UpdateInvoice are cheap to redo, and PostGL/PostStock must be redone
+// anyway since the rollback means nothing they wrote was ever committed.
+type SubmissionExecutor struct {
+        tx    *sql.Tx
+        reset func(ctx context.Context, si *SalesInvoice, tx *sql.Tx)
+        log   func(string)
+}
+
+// NewSubmissionExecutor returns a SubmissionExecutor whose PostGL and
+// PostStock states post against tx.
+func NewSubmissionExecutor(tx *sql.Tx, opts ...Option) *SubmissionExecutor {
+        e := &SubmissionExecutor{tx: tx}
+        for _, opt := range opts {
+                opt(e)
         }
+        return e
+}
+
+// Run executes si's submission state machine to completion, stopping early
+// if ctx is canceled or a state returns an error.
+func (e *SubmissionExecutor) Run(ctx context.Context, si *SalesInvoice) error {
+        si.tx = e.tx
+
+        state := si.nextState
+        if state == nil {
+                state = stateValidate
+        }
+
+        for state != nil {
+                if err := ctx.Err(); err != nil {
+                        if e.reset != nil {
+                                e.reset(ctx, si, e.tx)
+                        } else if e.tx != nil {
+                                e.tx.Rollback()
+                        }
+                        si.tx = nil
+                        si.nextState = nil
+                        return err
+                }
 
-        // Make general ledger entries
-        if err := si.makeGLEntries(ctx); err != nil {
-                return fmt.Errorf("failed to make general ledger entries: %w", err)
+                traceLen := len(si.Trace)
+                next, err := state(ctx, si)
+                if e.log != nil && len(si.Trace) > traceLen {
+                        e.log(si.Trace[len(si.Trace)-1])
+                }
+                if err != nil {
+                        if e.reset != nil {
+                                e.reset(ctx, si, e.tx)
+                        }
+                        si.nextState = nil
+                        return err
+                }
+                state = next
         }
 
+        si.nextState = nil
         return nil
 }
 
-// updateSalesInvoice updates the sales invoice.
-func (si *SalesInvoice) updateSalesInvoice(ctx context.Context) error {
-        // Call the sales invoice service to update the sales invoice
-        // For demonstration purposes, assume we have a SalesInvoiceService
-        salesInvoiceService := NewSalesInvoiceService()
+// stateValidate is the submission state machine's entry point. It rejects
+// an invoice missing the fields GL/stock posting depend on.
+func stateValidate(ctx context.Context, si *SalesInvoice) (StateFn, error) {
+        if si.Item == "" || si.Company == "" || si.Customer == "" || si.DebitTo == "" {
+                return nil, &domainerror.ValidationError{
+                        Message: fmt.Sprintf("sales invoice %s: item, company, customer, and debit_to are required", si.ID),
+                }
+        }
+        if si.Qty <= 0 {
+                return nil, &domainerror.ValidationError{
+                        Message: fmt.Sprintf("sales invoice %s: qty must be positive", si.ID),
+                }
+        }
+
+        si.recordState("Validate")
+        return stateUpdateInvoice, nil
+}
+
+// stateUpdateInvoice updates the sales invoice's persisted status.
+func stateUpdateInvoice(ctx context.Context, si *SalesInvoice) (StateFn, error) {
+        salesInvoiceService := NewSalesInvoiceService(si.Store)
+        if si.PostingDate.IsZero() {
+                si.PostingDate = salesInvoiceService.Clock.Now()
+        }
         if err := salesInvoiceService.UpdateSalesInvoice(ctx, si); err != nil {
-                return fmt.Errorf("failed to update sales invoice: %w", err)
+                return nil, &domainerror.ConflictError{
+                        Message: fmt.Sprintf("failed to update sales invoice %s", si.ID),
+                        Err:     err,
+                }
         }
 
-        return nil
+        si.recordState("UpdateInvoice")
+        return statePostGL, nil
 }
 
-// makeGLEntries makes general ledger entries.
-func (si *SalesInvoice) makeGLEntries(ctx context.Context) error {
-        // Call the general ledger service to make general ledger entries
-        // For demonstration purposes, assume we have a GeneralLedgerService
-        generalLedgerService := NewGeneralLedgerService()
-        if err := generalLedgerService.MakeGLEntries(ctx, si); err != nil {
-                return fmt.Errorf("failed to make general ledger entries: %w", err)
+// statePostGL makes this invoice's general ledger entries, against si.tx.
+func statePostGL(ctx context.Context, si *SalesInvoice) (StateFn, error) {
+        generalLedgerService := NewGeneralLedgerService(si.Store)
+        if err := generalLedgerService.MakeGLEntries(ctx, si.tx, si); err != nil {
+                return nil, err
         }
 
-        // Call the stock ledger service to make stock ledger entries
-        // For demonstration purposes, assume we have a StockLedgerService
-        stockLedgerService := NewStockLedgerService()
-        if err := stockLedgerService.MakeStockLedgerEntries(ctx, si); err != nil {
-                return fmt.Errorf("failed to make stock ledger entries: %w", err)
+        si.recordState("PostGL")
+        return statePostStock, nil
+}
+
+// statePostStock makes this invoice's stock ledger entries, against si.tx.
+func statePostStock(ctx context.Context, si *SalesInvoice) (StateFn, error) {
+        stockLedgerService := NewStockLedgerService(si.Store)
+        if err := stockLedgerService.MakeStockLedgerEntries(ctx, si.tx, si); err != nil {
+                return nil, err
+        }
+
+        si.recordState("PostStock")
+        return stateSubmitted, nil
+}
+
+// stateSubmitted marks the invoice submitted. It is the state machine's
+// terminal state: it returns (nil, nil) to end the run.
+func stateSubmitted(ctx context.Context, si *SalesInvoice) (StateFn, error) {
+        si.Submitted = true
+        si.recordState("Submitted")
+        return nil, nil
+}
+
+// OnSubmit drives the sales invoice through its submission state machine
+// (see SubmissionExecutor) inside a single GL/stock ledger transaction: if
+// any state fails, the transaction is rolled back.
+func (si *SalesInvoice) OnSubmit(ctx context.Context) error {
+        tx, err := si.Store.BeginTx(ctx)
+        if err != nil {
+                return &domainerror.GLBalanceError{
+                        Message: "failed to begin transaction for GL and stock ledger posting",
+                        Err:     err,
+                }
+        }
+
+        exec := NewSubmissionExecutor(tx, Reset(func(ctx context.Context, si *SalesInvoice, tx *sql.Tx) {
+                tx.Rollback()
+        }))
+        if err := exec.Run(ctx, si); err != nil {
+                return err
+        }
+
+        if err := tx.Commit(); err != nil {
+                return &domainerror.GLBalanceError{
+                        Message: "failed to commit GL and stock ledger transaction",
+                        Err:     err,
+                }
         }
 
         return nil
 }
 
-// NewSalesInvoiceService returns a new sales invoice service.
-func NewSalesInvoiceService() *SalesInvoiceService {
-        return &SalesInvoiceService{}
+// NewSalesInvoiceService returns a new sales invoice service backed by store,
+// stamping PostingDate from the real wall clock. Use
+// NewSalesInvoiceServiceWithClock to pin it to a fixed instant in tests.
+func NewSalesInvoiceService(store storage.Store) *SalesInvoiceService {
+        return NewSalesInvoiceServiceWithClock(store, clock.RealClock{})
+}
+
+// NewSalesInvoiceServiceWithClock returns a sales invoice service backed by
+// store, stamping PostingDate from c.
+func NewSalesInvoiceServiceWithClock(store storage.Store, c clock.Clock) *SalesInvoiceService {
+        return &SalesInvoiceService{Store: store, Clock: c}
 }
 
 // SalesInvoiceService provides functionality for managing sales invoices.
-type SalesInvoiceService struct{}
+type SalesInvoiceService struct {
+        Store storage.Store
+        Clock clock.Clock
+}
 
-// UpdateSalesInvoice updates a sales invoice.
+// UpdateSalesInvoice updates a sales invoice, first stamping a zero
+// PostingDate from s.Clock.
 func (s *SalesInvoiceService) UpdateSalesInvoice(ctx context.Context, si *SalesInvoice) error {
-    fmt.Println("   [SalesService] Updating Invoice Status...") // <--- ADD THIS
-    return nil
+        if si.PostingDate.IsZero() {
+                si.PostingDate = s.Clock.Now()
+        }
+        return s.Store.SetValue(ctx, "Sales Invoice", si.ID.String(), "status", "Submitted")
 }
 
-// NewGeneralLedgerService returns a new general ledger service.
-func NewGeneralLedgerService() *GeneralLedgerService {
-        return &GeneralLedgerService{}
+// NewGeneralLedgerService returns a new general ledger service backed by store.
+func NewGeneralLedgerService(store storage.Store) *GeneralLedgerService {
+        return &GeneralLedgerService{Store: store}
 }
 
 // GeneralLedgerService provides functionality for managing general ledger entries.
-type GeneralLedgerService struct{}
+type GeneralLedgerService struct {
+        Store storage.Store
+}
+
+// MakeGLEntries makes general ledger entries for si, against tx, then calls
+// the post_gl_entries stored procedure to get back the voucher number it
+// generated and the account's running balance after posting.
+func (s *GeneralLedgerService) MakeGLEntries(ctx context.Context, tx *sql.Tx, si *SalesInvoice) error {
+        debit := storage.GLEntry{
+                VoucherType:  "Sales Invoice",
+                VoucherNo:    si.ID.String(),
+                Account:      si.DebitTo,
+                DebitAmount:  si.Rate * si.Qty,
+                CreditAmount: 0,
+                PostingDate:  si.PostingDate,
+        }
+        if err := s.Store.InsertGLEntry(ctx, tx, debit); err != nil {
+                return &domainerror.GLBalanceError{
+                        Message: fmt.Sprintf("failed to insert GL entry for %s", debit.Account),
+                        Err:     err,
+                }
+        }
 
-// MakeGLEntries makes general ledger entries.
-func (s *GeneralLedgerService) MakeGLEntries(ctx context.Context, si *SalesInvoice) error {
-    fmt.Println("   [GLService] Creating Ledger Entries (Debit/Credit)...") // <--- ADD THIS
-    return nil
+        var voucherNo string
+        var runningBalance float64
+        err := s.Store.CallProcedure(ctx, "post_gl_entries", []storage.Param{
+                {Name: "voucher_type", Value: debit.VoucherType},
+                {Name: "voucher_no", Value: debit.VoucherNo},
+                {Name: "account", Value: debit.Account},
+                {Name: "debit", Value: debit.DebitAmount},
+                {Name: "credit", Value: debit.CreditAmount},
+        }, []storage.OutParam{
+                {Name: "generated_voucher_no", Dest: &voucherNo},
+                {Name: "running_balance", Dest: &runningBalance},
+        })
+        if err != nil {
+                return &domainerror.GLBalanceError{
+                        Message: fmt.Sprintf("failed to post GL entries via stored procedure for %s", debit.Account),
+                        Err:     err,
+                }
+        }
+        si.VoucherNo = voucherNo
+        si.RunningBalance = runningBalance
+
+        return nil
 }
 
-// NewStockLedgerService returns a new stock ledger service.
-func NewStockLedgerService() *StockLedgerService {
-        return &StockLedgerService{}
+// NewStockLedgerService returns a new stock ledger service backed by store.
+func NewStockLedgerService(store storage.Store) *StockLedgerService {
+        return &StockLedgerService{Store: store}
 }
 
 // StockLedgerService provides functionality for managing stock ledger entries.
-type StockLedgerService struct{}
+type StockLedgerService struct {
+        Store storage.Store
+}
 
-// MakeStockLedgerEntries makes stock ledger entries.
-func (s *StockLedgerService) MakeStockLedgerEntries(ctx context.Context, si *SalesInvoice) error {
-    fmt.Println("   [StockService] Updating Inventory...") // <--- ADD THIS
-    return nil
+// MakeStockLedgerEntries makes stock ledger entries for si, against tx.
+func (s *StockLedgerService) MakeStockLedgerEntries(ctx context.Context, tx *sql.Tx, si *SalesInvoice) error {
+        entry := storage.StockLedgerEntry{
+                ItemCode:    si.Item,
+                Warehouse:   si.CostCenter,
+                VoucherNo:   si.ID.String(),
+                Qty:         -si.Qty,
+                PostingDate: si.PostingDate,
+        }
+        if err := s.Store.InsertStockLedgerEntry(ctx, tx, entry); err != nil {
+                return &domainerror.StockUnavailableError{
+                        Message: fmt.Sprintf("failed to insert stock ledger entry for %s", entry.ItemCode),
+                        Err:     err,
+                }
+        }
+        return nil
 }
@@ -0,0 +1,315 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"testing"
+
+	"github.com/google/uuid"
+
+	"github.com/GughanS/erpnext-ast-analyzer/storage"
+)
+
+// fakeTx backs a real *sql.Tx without touching an actual database, so
+// SubmissionExecutor's PostGL/PostStock states (which post against a
+// *sql.Tx) can be exercised here, and so tests can assert whether a tx
+// was committed or rolled back.
+type fakeTx struct {
+	committed  bool
+	rolledBack bool
+}
+
+func (t *fakeTx) Commit() error   { t.committed = true; return nil }
+func (t *fakeTx) Rollback() error { t.rolledBack = true; return nil }
+
+// fakeConn is a driver.Conn whose Begin hands back a fresh fakeTx, recorded
+// so the test can inspect it after the fact.
+type fakeConn struct{ lastTx *fakeTx }
+
+func (c *fakeConn) Prepare(query string) (driver.Stmt, error) {
+	return nil, errors.New("fakeConn: Prepare not implemented")
+}
+func (c *fakeConn) Close() error { return nil }
+func (c *fakeConn) Begin() (driver.Tx, error) {
+	c.lastTx = &fakeTx{}
+	return c.lastTx, nil
+}
+
+type fakeSQLDriver struct{ conn *fakeConn }
+
+func (d *fakeSQLDriver) Open(name string) (driver.Conn, error) { return d.conn, nil }
+
+// sharedFakeConn is the single physical connection the fake driver ever
+// hands out; each BeginTx call against it produces a fresh fakeTx recorded
+// as sharedFakeConn.lastTx, so tests can assert whether that tx was
+// ultimately committed or rolled back. Safe because these tests run
+// sequentially against one *sql.Tx at a time.
+var sharedFakeConn = &fakeConn{}
+
+func init() {
+	sql.Register("salesinvoicetest_fake", &fakeSQLDriver{conn: sharedFakeConn})
+}
+
+// fakeStore is a hand-written storage.Store double: BeginTx needs to return
+// a real *sql.Tx (see fakeConn/fakeTx above), which a mockery-generated mock
+// can't produce, so the rest of the interface is implemented by hand too.
+type fakeStore struct {
+	db *sql.DB
+
+	setValueCalls int
+	glEntries     []storage.GLEntry
+	stockEntries  []storage.StockLedgerEntry
+}
+
+func newFakeStore(t *testing.T) *fakeStore {
+	db, err := sql.Open("salesinvoicetest_fake", "")
+	if err != nil {
+		t.Fatalf("failed to open fake driver: %v", err)
+	}
+	return &fakeStore{db: db}
+}
+
+func (s *fakeStore) GetValueStr(ctx context.Context, doctype, name, fieldname string) (string, error) {
+	return "", nil
+}
+
+func (s *fakeStore) SetValue(ctx context.Context, doctype, name, fieldname, value string) error {
+	s.setValueCalls++
+	return nil
+}
+
+func (s *fakeStore) GetBinDetails(ctx context.Context, binName string) (map[string]string, error) {
+	return nil, nil
+}
+
+func (s *fakeStore) GetActualQty(ctx context.Context, itemCode, warehouse string) (float64, error) {
+	return 0, nil
+}
+
+func (s *fakeStore) GetReservedQtyForProductionPlan(ctx context.Context, productionPlan, item string) (float64, error) {
+	return 0, nil
+}
+
+func (s *fakeStore) BeginTx(ctx context.Context) (*sql.Tx, error) {
+	return s.db.BeginTx(ctx, nil)
+}
+
+func (s *fakeStore) InsertGLEntry(ctx context.Context, tx *sql.Tx, entry storage.GLEntry) error {
+	s.glEntries = append(s.glEntries, entry)
+	return nil
+}
+
+func (s *fakeStore) InsertStockLedgerEntry(ctx context.Context, tx *sql.Tx, entry storage.StockLedgerEntry) error {
+	s.stockEntries = append(s.stockEntries, entry)
+	return nil
+}
+
+func (s *fakeStore) CallProcedure(ctx context.Context, name string, in []storage.Param, out []storage.OutParam) error {
+	for _, o := range out {
+		switch dest := o.Dest.(type) {
+		case *string:
+			*dest = "SI-0001"
+		case *float64:
+			*dest = 100.0
+		}
+	}
+	return nil
+}
+
+func validInvoice(store storage.Store) *SalesInvoice {
+	return &SalesInvoice{
+		ID:       uuid.New(),
+		Item:     "item-1",
+		Company:  "company-1",
+		Customer: "customer-1",
+		DebitTo:  "debtors-1",
+		Qty:      2,
+		Rate:     50,
+		Store:    store,
+	}
+}
+
+func TestOnSubmitRecordsTheExactTraceAndCommits(t *testing.T) {
+	store := newFakeStore(t)
+	si := validInvoice(store)
+
+	if err := si.OnSubmit(context.Background()); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	want := []string{"Validate", "UpdateInvoice", "PostGL", "PostStock", "Submitted"}
+	if len(si.Trace) != len(want) {
+		t.Fatalf("expected trace %v, got %v", want, si.Trace)
+	}
+	for i, name := range want {
+		if si.Trace[i] != name {
+			t.Errorf("expected trace[%d] = %q, got %q", i, name, si.Trace[i])
+		}
+	}
+
+	if !si.Submitted {
+		t.Error("expected invoice to be marked submitted")
+	}
+	if len(store.glEntries) != 1 || len(store.stockEntries) != 1 {
+		t.Errorf("expected exactly one GL entry and one stock entry, got %d and %d", len(store.glEntries), len(store.stockEntries))
+	}
+	if tx := sharedFakeConn.lastTx; tx == nil || !tx.committed {
+		t.Error("expected OnSubmit's transaction to be committed")
+	}
+}
+
+func TestSubmissionExecutorInvokesLogFacilityPerTransition(t *testing.T) {
+	store := newFakeStore(t)
+	si := validInvoice(store)
+
+	tx, err := store.BeginTx(context.Background())
+	if err != nil {
+		t.Fatalf("failed to begin tx: %v", err)
+	}
+
+	var logged []string
+	exec := NewSubmissionExecutor(tx, LogFacility(func(name string) {
+		logged = append(logged, name)
+	}))
+
+	if err := exec.Run(context.Background(), si); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	want := []string{"Validate", "UpdateInvoice", "PostGL", "PostStock", "Submitted"}
+	if len(logged) != len(want) {
+		t.Fatalf("expected log calls %v, got %v", want, logged)
+	}
+	for i, name := range want {
+		if logged[i] != name {
+			t.Errorf("expected logged[%d] = %q, got %q", i, name, logged[i])
+		}
+	}
+}
+
+// failingProcedureStore is a fakeStore whose CallProcedure always errors,
+// so statePostGL fails after stateValidate and stateUpdateInvoice have
+// already run and recorded their trace entries.
+type failingProcedureStore struct {
+	*fakeStore
+}
+
+func (s *failingProcedureStore) CallProcedure(ctx context.Context, name string, in []storage.Param, out []storage.OutParam) error {
+	return errors.New("post_gl_entries: simulated failure")
+}
+
+func TestSubmissionExecutorDoesNotLogADuplicateTransitionOnStateFailure(t *testing.T) {
+	store := &failingProcedureStore{fakeStore: newFakeStore(t)}
+	si := validInvoice(store)
+
+	tx, err := store.BeginTx(context.Background())
+	if err != nil {
+		t.Fatalf("failed to begin tx: %v", err)
+	}
+
+	var logged []string
+	exec := NewSubmissionExecutor(tx, LogFacility(func(name string) {
+		logged = append(logged, name)
+	}))
+
+	if err := exec.Run(context.Background(), si); err == nil {
+		t.Fatal("expected an error from the failing PostGL state")
+	}
+
+	want := []string{"Validate", "UpdateInvoice"}
+	if len(logged) != len(want) {
+		t.Fatalf("expected log calls %v (no duplicate for the failed PostGL state), got %v", want, logged)
+	}
+	for i, name := range want {
+		if logged[i] != name {
+			t.Errorf("expected logged[%d] = %q, got %q", i, name, logged[i])
+		}
+	}
+}
+
+func TestSubmissionExecutorInvokesResetOnStateError(t *testing.T) {
+	store := newFakeStore(t)
+	si := &SalesInvoice{Store: store} // missing required fields fails Validate
+
+	tx, err := store.BeginTx(context.Background())
+	if err != nil {
+		t.Fatalf("failed to begin tx: %v", err)
+	}
+
+	var resetCalled bool
+	exec := NewSubmissionExecutor(tx, Reset(func(ctx context.Context, si *SalesInvoice, tx *sql.Tx) {
+		resetCalled = true
+		tx.Rollback()
+	}))
+
+	if err := exec.Run(context.Background(), si); err == nil {
+		t.Fatal("expected an error from an invoice missing required fields")
+	}
+	if !resetCalled {
+		t.Error("expected Reset's fn to be invoked on a state error")
+	}
+	if si.nextState != nil {
+		t.Error("expected nextState to be cleared after an error")
+	}
+}
+
+// cancelOnBeginStore is a fakeStore whose BeginTx begins the transaction and
+// then cancels the submission's context, so OnSubmit reaches
+// SubmissionExecutor.Run holding a live *sql.Tx and a canceled ctx.
+type cancelOnBeginStore struct {
+	*fakeStore
+	cancel context.CancelFunc
+}
+
+func (s *cancelOnBeginStore) BeginTx(ctx context.Context) (*sql.Tx, error) {
+	tx, err := s.fakeStore.BeginTx(context.Background())
+	s.cancel()
+	return tx, err
+}
+
+func TestOnSubmitRollsBackTheAbandonedTxOnCancellationAndRestartsCleanOnResume(t *testing.T) {
+	canceled, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	store := &cancelOnBeginStore{fakeStore: newFakeStore(t), cancel: cancel}
+	si := validInvoice(store)
+
+	if err := si.OnSubmit(canceled); err == nil {
+		t.Fatal("expected an error from a canceled context")
+	}
+
+	// Confirm the first run's transaction was rolled back rather than left
+	// dangling, per storage.Store.BeginTx's contract that every begun
+	// transaction is eventually committed or rolled back.
+	firstTx := sharedFakeConn.lastTx
+	if firstTx == nil || !firstTx.rolledBack {
+		t.Error("expected the canceled run's transaction to be rolled back")
+	}
+	if si.nextState != nil {
+		t.Error("expected nextState to be cleared on cancellation, not pointed at the interrupted state")
+	}
+	if si.tx != nil {
+		t.Error("expected si.tx to be cleared after the canceled run's transaction was rolled back")
+	}
+
+	// Resubmitting restarts the whole state machine rather than resuming
+	// mid-transaction, so it still completes and posts exactly once.
+	if err := si.OnSubmit(context.Background()); err != nil {
+		t.Fatalf("expected the resumed submission to succeed, got %v", err)
+	}
+
+	want := []string{"Validate", "UpdateInvoice", "PostGL", "PostStock", "Submitted"}
+	if len(si.Trace) != len(want) {
+		t.Fatalf("expected trace %v, got %v", want, si.Trace)
+	}
+	for i, name := range want {
+		if si.Trace[i] != name {
+			t.Errorf("expected trace[%d] = %q, got %q", i, name, si.Trace[i])
+		}
+	}
+	if len(store.glEntries) != 1 || len(store.stockEntries) != 1 {
+		t.Errorf("expected exactly one GL entry and one stock entry after resume, got %d and %d", len(store.glEntries), len(store.stockEntries))
+	}
+}
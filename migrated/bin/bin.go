@@ -1,37 +1,111 @@
 package main
 
 import (
+	"context"
 	"fmt"
+
+	"github.com/GughanS/erpnext-ast-analyzer/clock"
+	"github.com/GughanS/erpnext-ast-analyzer/domainerror"
+	"github.com/GughanS/erpnext-ast-analyzer/migrated/bin/ledger"
+	"github.com/GughanS/erpnext-ast-analyzer/storage"
 )
 
 type Bin struct {
-	Name                             *string   // String pointer
-	Item                             *string   // String pointer
-	Warehouse                        *string   // String pointer
-	ActualQty                        *float64  // Numeric pointer (NOT *string)
-	ProjectedQty                     *float64  // Numeric pointer (NOT *string)
-	OrderedQty                       *float64  // Numeric pointer (NOT *string)
-	IndentedQty                      *float64  // Numeric pointer (NOT *string)
-	PlannedQty                       *float64  // Numeric pointer (NOT *string)
-	ReservedQty                      *float64  // Numeric pointer (NOT *string)
-	ReservedQtyForProduction         *float64  // Numeric pointer (NOT *string)
-	ReservedQtyForSubContract        *float64  // Numeric pointer (NOT *string)
-	isNew                            bool      // Boolean (NOT pointer)
+	Name                         *string  // String pointer
+	Item                         *string  // String pointer
+	Warehouse                    *string  // String pointer
+	StockUOM                     *string  // String pointer
+	ActualQty                    *float64 // Numeric pointer (NOT *string)
+	ProjectedQty                 *float64 // Numeric pointer (NOT *string)
+	OrderedQty                   *float64 // Numeric pointer (NOT *string)
+	IndentedQty                  *float64 // Numeric pointer (NOT *string)
+	PlannedQty                   *float64 // Numeric pointer (NOT *string)
+	ReservedQty                  *float64 // Numeric pointer (NOT *string)
+	ReservedQtyForProduction     *float64 // Numeric pointer (NOT *string)
+	ReservedQtyForProductionPlan *float64 // Numeric pointer (NOT *string)
+	ReservedQtyForSubContract    *float64 // Numeric pointer (NOT *string)
+	isNew                        bool     // Boolean (NOT pointer)
+}
+
+// DocValueStore reads and writes a single field on a document, mirroring
+// frappe's generic get_value/db_set accessors. getValueStr/dbGetValue/dbSet
+// delegate to defaultDocValueStore rather than a concrete storage.Store so
+// tests can swap in a generated mock without satisfying the rest of
+// storage.Store too.
+type DocValueStore interface {
+	GetValueStr(ctx context.Context, doctype, name, fieldname string) (string, error)
+	SetValue(ctx context.Context, doctype, name, fieldname, value string) error
+}
+
+// StockReader reads quantities Bin doesn't own: the actual qty of an
+// (item, warehouse) pair, and how much of an item a Production Plan has
+// reserved.
+type StockReader interface {
+	GetActualQty(ctx context.Context, itemCode, warehouse string) (float64, error)
+	GetReservedQtyForProductionPlan(ctx context.Context, productionPlan, item string) (float64, error)
+}
+
+// BinRepository reads the projected quantity columns of a single Bin row.
+type BinRepository interface {
+	GetBinDetails(ctx context.Context, binName string) (map[string]string, error)
+}
+
+// defaultDocValueStore, defaultStockReader, and defaultBinRepository are
+// what the package-level function variables below delegate to. NewBin sets
+// all three once at startup, from the same storage.Store, since
+// storage.Store satisfies all three interfaces; tests assign them directly
+// to narrower mocks instead of implementing storage.Store in full.
+var (
+	defaultDocValueStore DocValueStore
+	defaultStockReader   StockReader
+	defaultBinRepository BinRepository
+
+	// defaultClock stamps the CreatedAt of ledger entries posted by
+	// updateQty. NewBin sets it to clock.RealClock{}; tests assign a
+	// clock.FakeClock directly to pin "now" and assert exact values.
+	defaultClock clock.Clock = clock.RealClock{}
+)
+
+// storage.Store must keep satisfying DocValueStore, StockReader, and
+// BinRepository for NewBin's three-way assignment below to type-check --
+// asserted here so a future storage.Store signature change fails the build
+// right at the point it breaks Bin, not somewhere downstream.
+var (
+	_ DocValueStore = storage.Store(nil)
+	_ StockReader   = storage.Store(nil)
+	_ BinRepository = storage.Store(nil)
+)
+
+// NewBin points Bin's persistence at store. It's the context.Context-aware
+// constructor that replaces the old implicit stub-everything behavior; call
+// it once during startup before constructing any Bin.
+func NewBin(store storage.Store) *Bin {
+	defaultDocValueStore = store
+	defaultStockReader = store
+	defaultBinRepository = store
+	defaultClock = clock.RealClock{}
+	return &Bin{}
 }
 
 var getValueStr = func(doctype, name, fieldname string) (string, error) {
-	// Implementation here
-	return "", nil
+	if defaultDocValueStore == nil {
+		return "", nil
+	}
+	return defaultDocValueStore.GetValueStr(context.Background(), doctype, name, fieldname)
 }
 
 var dbGetValue = func(doctype, name, fieldname string) (string, error) {
-	// Implementation here
-	return "", nil
+	if defaultDocValueStore == nil {
+		return "", nil
+	}
+	return defaultDocValueStore.GetValueStr(context.Background(), doctype, name, fieldname)
 }
 
 var dbSet = func(doctype, name, fieldname, value string) error {
-	// Implementation here
-	return nil
+	if defaultDocValueStore == nil {
+		return nil
+	}
+	return defaultDocValueStore.SetValue(context.Background(), doctype, name, fieldname, value)
 }
 
 var makeAutoname = func(key string) string {
@@ -79,8 +153,14 @@ var renderTemplate = func(template string, data interface{}) string {
 }
 
 var getBinDetails = func(batch string) map[string]string {
-	// Implementation here
-	return map[string]string{}
+	if defaultBinRepository == nil {
+		return map[string]string{}
+	}
+	details, err := defaultBinRepository.GetBinDetails(context.Background(), batch)
+	if err != nil {
+		return map[string]string{}
+	}
+	return details
 }
 
 var getExpiryDetails = func(batch string) string {
@@ -89,36 +169,93 @@ var getExpiryDetails = func(batch string) string {
 }
 
 var getReservedQtyForProductionPlan = func(productionPlan, item string) float64 {
-	// Implementation here
-	return 0.0
+	if defaultStockReader == nil {
+		return 0.0
+	}
+	qty, err := defaultStockReader.GetReservedQtyForProductionPlan(context.Background(), productionPlan, item)
+	if err != nil {
+		return 0.0
+	}
+	return qty
 }
 
 var GetActualQty = func(itemCode, warehouse string) float64 {
-	// Implementation here
-	return 0.0
+	if defaultStockReader == nil {
+		return 0.0
+	}
+	qty, err := defaultStockReader.GetActualQty(context.Background(), itemCode, warehouse)
+	if err != nil {
+		return 0.0
+	}
+	return qty
 }
 
-func (b *Bin) recalculateQty() {
-	b.ActualQty = new(float64)
+// flt parses a quantity string, mirroring the frappe.utils.flt helper. It is
+// a function variable so tests can reassign it, matching the rest of this
+// file's dependency pattern.
+var flt = func(val string) float64 {
+	var f float64
+	fmt.Sscanf(val, "%f", &f)
+	return f
+}
 
-	plannedQtyStr, _ := getValueStr("Bin", *b.Item, "planned_qty")
-	b.PlannedQty = new(float64)
+// stockLedger is the package-level ledger.Service that backs Bin's quantity
+// columns. recalculateQty and updateQty post TransactionEntry rows here
+// instead of overwriting scalars directly; the columns themselves become a
+// projection computed by ledger.Service.Project.
+var stockLedger = ledger.NewService()
+
+// recalculateQty projects this Bin's quantity columns from the posted
+// ledger entries. It returns a *domainerror.NotFoundError if no projection
+// could be computed for the (Item, Warehouse) pair, instead of silently
+// leaving the Bin's columns stale.
+func (b *Bin) recalculateQty() error {
+	if err := b.updateReservedQtyForSubContracting(false); err != nil {
+		return err
+	}
+	if err := b.updateReservedQtyForProductionPlan(true, false); err != nil {
+		return err
+	}
 
-	indentedQtyStr, _ := getValueStr("Bin", *b.Item, "indented_qty")
-	b.IndentedQty = new(float64)
+	projection, err := stockLedger.Project(*b.Item, *b.Warehouse)
+	if err != nil {
+		return &domainerror.NotFoundError{
+			Message: fmt.Sprintf("bin: no ledger projection for item %s in warehouse %s", *b.Item, *b.Warehouse),
+			Err:     err,
+		}
+	}
 
-	orderedQtyStr, _ := getValueStr("Bin", *b.Item, "ordered_qty")
-	b.OrderedQty = new(float64)
+	b.ActualQty = &projection.ActualQty
+	b.PlannedQty = &projection.PlannedQty
+	b.IndentedQty = &projection.IndentedQty
+	b.OrderedQty = &projection.OrderedQty
+	b.ReservedQty = &projection.ReservedQty
+	b.ReservedQtyForProduction = &projection.ReservedQtyForProduction
+	b.ReservedQtyForSubContract = &projection.ReservedQtyForSubContract
+	b.ReservedQtyForProductionPlan = &projection.ReservedQtyForProductionPlan
 
-	reservedQtyStr, _ := getValueStr("Bin", *b.Item, "reserved_qty")
-	b.ReservedQty = new(float64)
+	b.setProjectedQty()
 
-	reservedQtyForProductionStr, _ := getValueStr("Bin", *b.Item, "reserved_qty_for_production")
-	b.ReservedQtyForProduction = new(float64)
+	binName := b.docName()
+	dbSet("Bin", binName, "actual_qty", fmt.Sprintf("%f", *b.ActualQty))
+	dbSet("Bin", binName, "planned_qty", fmt.Sprintf("%f", *b.PlannedQty))
+	dbSet("Bin", binName, "indented_qty", fmt.Sprintf("%f", *b.IndentedQty))
+	dbSet("Bin", binName, "ordered_qty", fmt.Sprintf("%f", *b.OrderedQty))
+	dbSet("Bin", binName, "reserved_qty", fmt.Sprintf("%f", *b.ReservedQty))
+	dbSet("Bin", binName, "projected_qty", fmt.Sprintf("%f", *b.ProjectedQty))
 
-	b.updateReservedQtyForSubContracting(false)
-	b.updateReservedQtyForProductionPlan(true, false)
-	b.setProjectedQty()
+	return nil
+}
+
+// docName returns the document name recalculateQty and the
+// updateReservedQtyFor* methods key dbSet/getBinDetails calls off: Name
+// when it's set, falling back to Item since frappe names documents lazily
+// and a Bin's Name isn't always populated before its first save.
+func (b *Bin) docName() string {
+	if b.Name != nil {
+		return *b.Name
+	}
+	return *b.Item
 }
 
 func (b *Bin) beforeSave() {
@@ -130,31 +267,102 @@ func (b *Bin) beforeSave() {
 }
 
 func (b *Bin) setProjectedQty() {
-	total := *b.ActualQty + *b.OrderedQty + *b.IndentedQty + *b.PlannedQty - *b.ReservedQty - *b.ReservedQtyForProduction - *b.ReservedQtyForSubContract
-	b.ProjectedQty = new(float64)
+	total := floatOrZero(b.ActualQty) + floatOrZero(b.OrderedQty) + floatOrZero(b.IndentedQty) + floatOrZero(b.PlannedQty) -
+		floatOrZero(b.ReservedQty) - floatOrZero(b.ReservedQtyForProduction) - floatOrZero(b.ReservedQtyForSubContract) - floatOrZero(b.ReservedQtyForProductionPlan)
+	b.ProjectedQty = &total
 }
 
-func (b *Bin) updateReservedQtyForProductionPlan(skipProjectQtyUpdate bool, updateQty bool) {
-	reservedQtyForProductionPlan := getReservedQtyForProductionPlan(*b.Item, *b.Warehouse)
+// floatOrZero reads f, treating a nil pointer as 0 -- Bin's quantity
+// columns aren't all populated until recalculateQty/beforeSave run.
+func floatOrZero(f *float64) float64 {
+	if f == nil {
+		return 0
+	}
+	return *f
+}
+
+// postReservedQtyDelta reconciles one of Bin's externally-sourced
+// reserved-qty holds (sub-contracting, production plan) against the
+// ledger. It's the "fee-style hold" the ledger package's doc comment
+// describes: reserveType is posted as a new reserve entry when the
+// external source now reserves more than the ledger currently projects,
+// and reversalType releases the difference when it reserves less. Calling
+// it again with an unchanged external value is a no-op, since the delta
+// against the ledger's current projection is then zero.
+func (b *Bin) postReservedQtyDelta(reserveType, reversalType ledger.EntryType, external float64) error {
+	projection, err := stockLedger.Project(*b.Item, *b.Warehouse)
+	if err != nil {
+		return err
+	}
 
-	if reservedQtyForProductionPlan == 0 && *b.ReservedQtyForProductionPlan == 0 {
-		return
+	var current float64
+	switch reserveType {
+	case ledger.EntryTypeReservedForProductionPlan:
+		current = projection.ReservedQtyForProductionPlan
+	case ledger.EntryTypeReservedForSubContract:
+		current = projection.ReservedQtyForSubContract
 	}
 
-	b.ReservedQtyForProductionPlan = new(float64)
+	delta := external - current
+	if delta == 0 {
+		return nil
+	}
+
+	entryType, qty := reserveType, delta
+	if delta < 0 {
+		entryType, qty = reversalType, -delta
+	}
+
+	now := defaultClock.Now()
+	return stockLedger.Post(ledger.TransactionEntry{
+		ID:              fmt.Sprintf("%s-%s-%s-%d", *b.Item, *b.Warehouse, entryType, now.UnixNano()),
+		ParentID:        b.docName(),
+		ItemCode:        *b.Item,
+		Warehouse:       *b.Warehouse,
+		DebitAccountID:  fmt.Sprintf("Bin.%s", entryType),
+		CreditAccountID: "StockMovement",
+		Amount:          int64(qty * ledger.QtyScale),
+		InvoiceRef:      fmt.Sprintf("resync-%d", now.UnixNano()),
+		EntryType:       entryType,
+		CreatedAt:       now,
+	})
+}
+
+func (b *Bin) updateReservedQtyForProductionPlan(skipProjectQtyUpdate bool, updateQty bool) error {
+	reservedQtyForProductionPlan := getReservedQtyForProductionPlan(*b.Item, *b.Warehouse)
+
+	if err := b.postReservedQtyDelta(ledger.EntryTypeReservedForProductionPlan, ledger.EntryTypeReservedForProductionPlanReversal, reservedQtyForProductionPlan); err != nil {
+		return err
+	}
 
 	if updateQty {
-		dbSet("Bin", *b.Name, "reserved_qty_for_production_plan", fmt.Sprintf("%f", *b.ReservedQtyForProductionPlan))
+		dbSet("Bin", b.docName(), "reserved_qty_for_production_plan", fmt.Sprintf("%f", reservedQtyForProductionPlan))
 	}
 
 	if !skipProjectQtyUpdate {
 		b.setProjectedQty()
-		dbSet("Bin", *b.Name, "projected_qty", fmt.Sprintf("%f", *b.ProjectedQty))
+		dbSet("Bin", b.docName(), "projected_qty", fmt.Sprintf("%f", *b.ProjectedQty))
 	}
+	return nil
 }
 
-func (b *Bin) updateReservedQtyForSubContracting(updateQty bool) {
-	// Implementation here
+// updateReservedQtyForSubContracting reconciles ReservedQtyForSubContract
+// against the Bin row's own reserved_qty_for_sub_contract column (read via
+// getBinDetails, same as the pre-ledger implementation), since -- unlike
+// production-plan reservations -- sub-contracting reservations aren't
+// sourced from a separate doctype.
+func (b *Bin) updateReservedQtyForSubContracting(updateQty bool) error {
+	details := getBinDetails(b.docName())
+	reservedQtyForSubContract := flt(details["reserved_qty_for_sub_contract"])
+
+	if err := b.postReservedQtyDelta(ledger.EntryTypeReservedForSubContract, ledger.EntryTypeReservedForSubContractReversal, reservedQtyForSubContract); err != nil {
+		return err
+	}
+
+	if updateQty {
+		dbSet("Bin", b.docName(), "reserved_qty_for_sub_contract", fmt.Sprintf("%f", reservedQtyForSubContract))
+	}
+	return nil
 }
 
 func (b *Bin) updateReservedStock() {
@@ -162,27 +370,71 @@ func (b *Bin) updateReservedStock() {
 	dbSet("Bin", *b.Name, "reserved_stock", fmt.Sprintf("%f", reservedStock))
 }
 
-func updateQty(binName string, args map[string]interface{}) {
+// updateQty translates the incoming stock-event args into typed
+// ledger.TransactionEntry rows and posts them as a single batch, rather than
+// overwriting the Bin's scalar columns directly. The caller's invoice/voucher
+// reference makes replayed stock events idempotent: posting the same event
+// twice posts no duplicate entries.
+func updateQty(binName string, args map[string]interface{}) error {
+	itemCode, _ := args["item_code"].(string)
+	warehouse, _ := args["warehouse"].(string)
+	invoiceRef, _ := args["voucher_no"].(string)
+
 	binDetails := getBinDetails(binName)
-	actualQty := binDetails["actual_qty"]
+	now := defaultClock.Now()
+
+	entries := []ledger.TransactionEntry{}
+	post := func(entryType ledger.EntryType, qty float64) {
+		if qty == 0 {
+			return
+		}
+		entries = append(entries, ledger.TransactionEntry{
+			ID:              fmt.Sprintf("%s-%s-%s", binName, entryType, invoiceRef),
+			ParentID:        binName,
+			ItemCode:        itemCode,
+			Warehouse:       warehouse,
+			DebitAccountID:  fmt.Sprintf("Bin.%s", entryType),
+			CreditAccountID: "StockMovement",
+			Amount:          int64(qty * ledger.QtyScale),
+			InvoiceRef:      invoiceRef,
+			EntryType:       entryType,
+			CreatedAt:       now,
+		})
+	}
 
 	if futureSleExists(args) {
-		actualQty = GetActualQty(args["item_code"].(string), args["warehouse"].(string))
+		post(ledger.EntryTypeActual, GetActualQty(itemCode, warehouse)-flt(binDetails["actual_qty"]))
+	} else if qtyStr, ok := args["actual_qty"].(string); ok {
+		post(ledger.EntryTypeActual, flt(qtyStr))
 	}
 
-	orderedQty := flt(binDetails["ordered_qty"]) + flt(args["ordered_qty"].(string))
-	reservedQty := flt(binDetails["reserved_qty"]) + flt(args["reserved_qty"].(string))
-	indentedQty := flt(binDetails["indented_qty"]) + flt(args["indented_qty"].(string))
-	plannedQty := flt(binDetails["planned_qty"]) + flt(args["planned_qty"].(string))
+	if qtyStr, ok := args["ordered_qty"].(string); ok {
+		post(ledger.EntryTypeOrdered, flt(qtyStr))
+	}
+	if qtyStr, ok := args["reserved_qty"].(string); ok {
+		post(ledger.EntryTypeReserved, flt(qtyStr))
+	}
+	if qtyStr, ok := args["indented_qty"].(string); ok {
+		post(ledger.EntryTypeIndented, flt(qtyStr))
+	}
+	if qtyStr, ok := args["planned_qty"].(string); ok {
+		post(ledger.EntryTypePlanned, flt(qtyStr))
+	}
 
-	projectedQty := actualQty + orderedQty + indentedQty + plannedQty - reservedQty - flt(binDetails["reserved_qty_for_production"]) - flt(binDetails["reserved_qty_for_sub_contract"]) - flt(binDetails["reserved_qty_for_production_plan"])
+	if err := stockLedger.PostBatch(entries); err != nil {
+		return err
+	}
 
-	dbSet("Bin", binName, "actual_qty", fmt.Sprintf("%f", actualQty))
-	dbSet("Bin", binName, "ordered_qty", fmt.Sprintf("%f", orderedQty))
-	dbSet("Bin", binName, "reserved_qty", fmt.Sprintf("%f", reservedQty))
-	dbSet("Bin", binName, "indented_qty", fmt.Sprintf("%f", indentedQty))
-	dbSet("Bin", binName, "planned_qty", fmt.Sprintf("%f", plannedQty))
-	dbSet("Bin", binName, "projected_qty", fmt.Sprintf("%f", projectedQty))
+	projection, err := stockLedger.Project(itemCode, warehouse)
+	if err != nil {
+		return err
+	}
+	dbSet("Bin", binName, "actual_qty", fmt.Sprintf("%f", projection.ActualQty))
+	dbSet("Bin", binName, "ordered_qty", fmt.Sprintf("%f", projection.OrderedQty))
+	dbSet("Bin", binName, "reserved_qty", fmt.Sprintf("%f", projection.ReservedQty))
+	dbSet("Bin", binName, "indented_qty", fmt.Sprintf("%f", projection.IndentedQty))
+	dbSet("Bin", binName, "planned_qty", fmt.Sprintf("%f", projection.PlannedQty))
+	return nil
 }
 
 func getActualQty(itemCode, warehouse string) float64 {
@@ -2,81 +2,107 @@ package main
 
 import (
 	"testing"
+	"time"
+
+	"github.com/GughanS/erpnext-ast-analyzer/clock"
+	"github.com/GughanS/erpnext-ast-analyzer/migrated/bin/ledger"
+	mocks "github.com/GughanS/erpnext-ast-analyzer/migrated/bin/testing"
+	"github.com/stretchr/testify/mock"
 )
 
+func TestDocValueAccessorsDelegateToDefaultDocValueStore(t *testing.T) {
+	origDocValueStore := defaultDocValueStore
+	defer func() { defaultDocValueStore = origDocValueStore }()
+
+	mockStore := new(mocks.MockDocValueStore)
+	mockStore.On("SetValue", mock.Anything, "Bin", "bin1", "actual_qty", "42.000000").Return(nil)
+	mockStore.On("GetValueStr", mock.Anything, "Bin", "bin1", "actual_qty").Return("42.000000", nil)
+	defaultDocValueStore = mockStore
+
+	if err := dbSet("Bin", "bin1", "actual_qty", "42.000000"); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	got, err := getValueStr("Bin", "bin1", "actual_qty")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if got != "42.000000" {
+		t.Errorf("expected getValueStr to return the wired store's value, got %q", got)
+	}
+	mockStore.AssertExpectations(t)
+}
+
 func TestRecalculateQty(t *testing.T) {
 	// Save originals
-	origGetActualQty := GetActualQty
-	origGetReservedQtyForProductionPlan := getReservedQtyForProductionPlan
-	origDbSet := dbSet
+	origDefaultStockReader := defaultStockReader
+	origDocValueStore := defaultDocValueStore
+	origStockLedger := stockLedger
 
-	// Mock by REASSIGNING the function variable (not calling it)
-	GetActualQty = func(itemCode, warehouse string) float64 {
-		return 100.0
-	}
+	mockStockReader := new(mocks.MockStockReader)
+	mockStockReader.On("GetReservedQtyForProductionPlan", mock.Anything, mock.Anything, mock.Anything).Return(50.0, nil)
+	defaultStockReader = mockStockReader
 
-	getReservedQtyForProductionPlan = func(productionPlan, item string) float64 {
-		return 50.0
-	}
+	mockDocValueStore := new(mocks.MockDocValueStore)
+	mockDocValueStore.On("SetValue", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(nil)
+	defaultDocValueStore = mockDocValueStore
 
-	dbSet = func(doctype, name, fieldname, value string) error {
-		return nil
-	}
+	stockLedger = ledger.NewService()
+	stockLedger.Post(ledger.TransactionEntry{
+		ID:         "actual-1",
+		ItemCode:   "item1",
+		Warehouse:  "warehouse1",
+		InvoiceRef: "SLE-1",
+		EntryType:  ledger.EntryTypeActual,
+		Amount:     100 * ledger.QtyScale,
+	})
 
 	// Restore
 	defer func() {
-		GetActualQty = origGetActualQty
-		getReservedQtyForProductionPlan = origGetReservedQtyForProductionPlan
-		dbSet = origDbSet
+		defaultStockReader = origDefaultStockReader
+		defaultDocValueStore = origDocValueStore
+		stockLedger = origStockLedger
 	}()
 
 	bin := &Bin{
-		Item:                             stringPtr("item1"),
-		Warehouse:                        stringPtr("warehouse1"),
-		ActualQty:                        float64Ptr(0),
-		PlannedQty:                       float64Ptr(0),
-		IndentedQty:                      float64Ptr(0),
-		OrderedQty:                       float64Ptr(0),
-		ReservedQty:                      float64Ptr(0),
-		ReservedQtyForProduction:         float64Ptr(0),
-		ReservedQtyForProductionPlan:     float64Ptr(0),
-		isNew:                            true,
+		Item:                         stringPtr("item1"),
+		Warehouse:                    stringPtr("warehouse1"),
+		ActualQty:                    float64Ptr(0),
+		PlannedQty:                   float64Ptr(0),
+		IndentedQty:                  float64Ptr(0),
+		OrderedQty:                   float64Ptr(0),
+		ReservedQty:                  float64Ptr(0),
+		ReservedQtyForProduction:     float64Ptr(0),
+		ReservedQtyForProductionPlan: float64Ptr(0),
+		isNew:                        true,
 	}
 
-	bin.recalculateQty()
+	if err := bin.recalculateQty(); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
 
 	if *bin.ActualQty != 100.0 {
 		t.Errorf("Expected ActualQty to be 100.0, got %f", *bin.ActualQty)
 	}
-	if *bin.ReservedQtyForProductionPlan != 50.0 {
-		t.Errorf("Expected ReservedQtyForProductionPlan to be 50.0, got %f", *bin.ReservedQtyForProductionPlan)
-	}
 }
 
 func TestBeforeSave(t *testing.T) {
 	// Save originals
-	origGetValueStr := getValueStr
-	origDbSet := dbSet
-
-	// Mock by REASSIGNING the function variable (not calling it)
-	getValueStr = func(doctype, name, fieldname string) (string, error) {
-		return "pcs", nil
-	}
+	origDocValueStore := defaultDocValueStore
 
-	dbSet = func(doctype, name, fieldname, value string) error {
-		return nil
-	}
+	mockDocValueStore := new(mocks.MockDocValueStore)
+	mockDocValueStore.On("GetValueStr", mock.Anything, "Item", "item1", "stock_uom").Return("pcs", nil)
+	mockDocValueStore.On("SetValue", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(nil)
+	defaultDocValueStore = mockDocValueStore
 
 	// Restore
 	defer func() {
-		getValueStr = origGetValueStr
-		dbSet = origDbSet
+		defaultDocValueStore = origDocValueStore
 	}()
 
 	bin := &Bin{
-		Item:     stringPtr("item1"),
+		Item:      stringPtr("item1"),
 		Warehouse: stringPtr("warehouse1"),
-		isNew:    true,
+		isNew:     true,
 	}
 
 	bin.beforeSave()
@@ -88,57 +114,222 @@ func TestBeforeSave(t *testing.T) {
 
 func TestUpdateQty(t *testing.T) {
 	// Save originals
-	origGetBinDetails := getBinDetails
-	origGetActualQty := GetActualQty
-	origDbSet := dbSet
+	origDefaultBinRepository := defaultBinRepository
+	origDefaultStockReader := defaultStockReader
+	origDocValueStore := defaultDocValueStore
+	origStockLedger := stockLedger
+
+	mockBinRepository := new(mocks.MockBinRepository)
+	mockBinRepository.On("GetBinDetails", mock.Anything, "bin1").Return(map[string]string{
+		"actual_qty":                    "100",
+		"ordered_qty":                   "50",
+		"reserved_qty":                  "20",
+		"indented_qty":                  "30",
+		"planned_qty":                   "40",
+		"reserved_qty_for_production":   "10",
+		"reserved_qty_for_sub_contract": "5",
+		"reserved_qty_for_production_plan": "15",
+	}, nil)
+	defaultBinRepository = mockBinRepository
+
+	mockStockReader := new(mocks.MockStockReader)
+	mockStockReader.On("GetActualQty", mock.Anything, mock.Anything, mock.Anything).Return(120.0, nil)
+	defaultStockReader = mockStockReader
+
+	mockDocValueStore := new(mocks.MockDocValueStore)
+	mockDocValueStore.On("SetValue", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(nil)
+	defaultDocValueStore = mockDocValueStore
 
-	// Mock by REASSIGNING the function variable (not calling it)
-	getBinDetails = func(batch string) map[string]string {
-		return map[string]string{
-			"actual_qty":              "100",
-			"ordered_qty":             "50",
-			"reserved_qty":            "20",
-			"indented_qty":            "30",
-			"planned_qty":             "40",
-			"reserved_qty_for_production": "10",
-			"reserved_qty_for_sub_contract": "5",
-			"reserved_qty_for_production_plan": "15",
-		}
+	stockLedger = ledger.NewService()
+
+	// Restore
+	defer func() {
+		defaultBinRepository = origDefaultBinRepository
+		defaultStockReader = origDefaultStockReader
+		defaultDocValueStore = origDocValueStore
+		stockLedger = origStockLedger
+	}()
+
+	args := map[string]interface{}{
+		"item_code":    "item1",
+		"warehouse":    "warehouse1",
+		"voucher_no":   "SLE-1",
+		"ordered_qty":  "10",
+		"reserved_qty": "5",
+		"indented_qty": "5",
+		"planned_qty":  "5",
 	}
 
-	GetActualQty = func(itemCode, warehouse string) float64 {
-		return 120.0
+	if err := updateQty("bin1", args); err != nil {
+		t.Fatalf("expected no error, got %v", err)
 	}
 
-	dbSet = func(doctype, name, fieldname, value string) error {
-		return nil
+	bin, err := stockLedger.Project("item1", "warehouse1")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if bin.OrderedQty != 10 {
+		t.Errorf("Expected OrderedQty to be 10, got %f", bin.OrderedQty)
 	}
 
-	// Restore
+	// Posting the same event again must be a no-op (idempotent on InvoiceRef).
+	if err := updateQty("bin1", args); err != nil {
+		t.Fatalf("expected no error on replay, got %v", err)
+	}
+	bin, _ = stockLedger.Project("item1", "warehouse1")
+	if bin.OrderedQty != 10 {
+		t.Errorf("Expected replayed updateQty to be idempotent, OrderedQty = %f", bin.OrderedQty)
+	}
+}
+
+// countingClock wraps a clock.Clock and counts how many times Now() was
+// called, so TestUpdateQtyConsultsTheClock can assert updateQty reads the
+// injected clock instead of calling time.Now() directly.
+type countingClock struct {
+	clock.Clock
+	calls int
+}
+
+func (c *countingClock) Now() time.Time {
+	c.calls++
+	return c.Clock.Now()
+}
+
+func TestUpdateQtyConsultsTheClock(t *testing.T) {
+	origDefaultBinRepository := defaultBinRepository
+	origDefaultStockReader := defaultStockReader
+	origDocValueStore := defaultDocValueStore
+	origStockLedger := stockLedger
+	origClock := defaultClock
+
+	mockBinRepository := new(mocks.MockBinRepository)
+	mockBinRepository.On("GetBinDetails", mock.Anything, "bin1").Return(map[string]string{}, nil)
+	defaultBinRepository = mockBinRepository
+
+	mockStockReader := new(mocks.MockStockReader)
+	defaultStockReader = mockStockReader
+
+	mockDocValueStore := new(mocks.MockDocValueStore)
+	mockDocValueStore.On("SetValue", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(nil)
+	defaultDocValueStore = mockDocValueStore
+
+	stockLedger = ledger.NewService()
+
+	frozen := time.Date(2026, 1, 15, 0, 0, 0, 0, time.UTC)
+	cc := &countingClock{Clock: clock.NewFakeClock(frozen)}
+	defaultClock = cc
+
 	defer func() {
-		getBinDetails = origGetBinDetails
-		GetActualQty = origGetActualQty
-		dbSet = origDbSet
+		defaultBinRepository = origDefaultBinRepository
+		defaultStockReader = origDefaultStockReader
+		defaultDocValueStore = origDocValueStore
+		stockLedger = origStockLedger
+		defaultClock = origClock
 	}()
 
 	args := map[string]interface{}{
-		"item_code":     "item1",
-		"warehouse":     "warehouse1",
-		"ordered_qty":   "10",
-		"reserved_qty":  "5",
-		"indented_qty":  "5",
-		"planned_qty":   "5",
+		"item_code":   "item1",
+		"warehouse":   "warehouse1",
+		"voucher_no":  "SLE-1",
+		"ordered_qty": "10",
+	}
+
+	if err := updateQty("bin1", args); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if cc.calls == 0 {
+		t.Error("expected updateQty to read the injected clock at least once")
+	}
+}
+
+func TestRecalculateQtyPostsProductionPlanAndSubContractHolds(t *testing.T) {
+	origDefaultStockReader := defaultStockReader
+	origDefaultBinRepository := defaultBinRepository
+	origDocValueStore := defaultDocValueStore
+	origStockLedger := stockLedger
+
+	mockStockReader := new(mocks.MockStockReader)
+	mockStockReader.On("GetReservedQtyForProductionPlan", mock.Anything, mock.Anything, mock.Anything).Return(50.0, nil)
+	defaultStockReader = mockStockReader
+
+	mockBinRepository := new(mocks.MockBinRepository)
+	mockBinRepository.On("GetBinDetails", mock.Anything, "item1").Return(map[string]string{
+		"reserved_qty_for_sub_contract": "15",
+	}, nil)
+	defaultBinRepository = mockBinRepository
+
+	mockDocValueStore := new(mocks.MockDocValueStore)
+	mockDocValueStore.On("SetValue", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(nil)
+	defaultDocValueStore = mockDocValueStore
+
+	stockLedger = ledger.NewService()
+
+	defer func() {
+		defaultStockReader = origDefaultStockReader
+		defaultDocValueStore = origDocValueStore
+		defaultBinRepository = origDefaultBinRepository
+		stockLedger = origStockLedger
+	}()
+
+	bin := &Bin{
+		Item:      stringPtr("item1"),
+		Warehouse: stringPtr("warehouse1"),
+	}
+
+	if err := bin.recalculateQty(); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if *bin.ReservedQtyForProductionPlan != 50.0 {
+		t.Errorf("expected ReservedQtyForProductionPlan 50.0, got %f", *bin.ReservedQtyForProductionPlan)
+	}
+	if *bin.ReservedQtyForSubContract != 15.0 {
+		t.Errorf("expected ReservedQtyForSubContract 15.0, got %f", *bin.ReservedQtyForSubContract)
+	}
+
+	// A second recalc against an unchanged external source must not post a
+	// second reserve entry on top of the first.
+	if err := bin.recalculateQty(); err != nil {
+		t.Fatalf("expected no error on second recalc, got %v", err)
+	}
+	if *bin.ReservedQtyForProductionPlan != 50.0 {
+		t.Errorf("expected ReservedQtyForProductionPlan to stay 50.0 after a repeat recalc, got %f", *bin.ReservedQtyForProductionPlan)
+	}
+	if *bin.ReservedQtyForSubContract != 15.0 {
+		t.Errorf("expected ReservedQtyForSubContract to stay 15.0 after a repeat recalc, got %f", *bin.ReservedQtyForSubContract)
+	}
+}
+
+func TestPostReservedQtyDeltaReversesAReleasedHold(t *testing.T) {
+	origStockLedger := stockLedger
+	stockLedger = ledger.NewService()
+	defer func() { stockLedger = origStockLedger }()
+
+	bin := &Bin{Item: stringPtr("item1"), Warehouse: stringPtr("warehouse1")}
+
+	if err := bin.postReservedQtyDelta(ledger.EntryTypeReservedForProductionPlan, ledger.EntryTypeReservedForProductionPlanReversal, 50.0); err != nil {
+		t.Fatalf("expected no error, got %v", err)
 	}
 
-	updateQty("bin1", args)
+	// The hold is fully released: the external source now reports 0.
+	if err := bin.postReservedQtyDelta(ledger.EntryTypeReservedForProductionPlan, ledger.EntryTypeReservedForProductionPlanReversal, 0); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
 
-	// You can add assertions here to verify the expected behavior
+	projection, err := stockLedger.Project("item1", "warehouse1")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if projection.ReservedQtyForProductionPlan != 0 {
+		t.Errorf("expected the hold to net to 0 after release, got %f", projection.ReservedQtyForProductionPlan)
+	}
 }
-  
+
 func stringPtr(s string) *string {
 	return &s
 }
 
 func float64Ptr(f float64) *float64 {
 	return &f
-}
\ No newline at end of file
+}
@@ -0,0 +1,204 @@
+// Package ledger implements a double-entry transaction-entry subsystem for
+// Bin quantity mutations. Columns such as ActualQty, ReservedQty, etc. are
+// no longer overwritten in place; instead every mutation is posted as a
+// TransactionEntry and the columns become a projection (a sum) over the
+// entries posted for an (ItemCode, Warehouse) pair.
+package ledger
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// EntryType identifies which Bin quantity bucket a TransactionEntry affects.
+// Reversal variants undo a prior entry by posting a new entry of the
+// opposite sign rather than mutating or deleting the original.
+type EntryType string
+
+const (
+	EntryTypeActual                    EntryType = "actual"
+	EntryTypeOrdered                   EntryType = "ordered"
+	EntryTypeReserved                  EntryType = "reserved"
+	EntryTypeIndented                  EntryType = "indented"
+	EntryTypePlanned                   EntryType = "planned"
+	EntryTypeReservedForProduction     EntryType = "reserved_for_production"
+	EntryTypeReservedForSubContract    EntryType = "reserved_for_sub_contract"
+	EntryTypeReservedForProductionPlan EntryType = "reserved_for_production_plan"
+
+	EntryTypeActualReversal                    EntryType = "actual_reversal"
+	EntryTypeOrderedReversal                   EntryType = "ordered_reversal"
+	EntryTypeReservedReversal                  EntryType = "reserved_reversal"
+	EntryTypeIndentedReversal                  EntryType = "indented_reversal"
+	EntryTypePlannedReversal                   EntryType = "planned_reversal"
+	EntryTypeReservedForProductionReversal     EntryType = "reserved_for_production_reversal"
+	EntryTypeReservedForSubContractReversal    EntryType = "reserved_for_sub_contract_reversal"
+	EntryTypeReservedForProductionPlanReversal EntryType = "reserved_for_production_plan_reversal"
+)
+
+// QtyScale is the fixed-point scale applied to quantities before they are
+// stored as Amount, so ledger arithmetic never touches a float.
+const QtyScale = 10000
+
+// Account is one side of a TransactionEntry. Stock-quantity buckets (e.g.
+// "Bin.ActualQty") are modelled as accounts, mirroring how GeneralLedgerService
+// models debit/credit accounts for money.
+type Account struct {
+	ID   string
+	Name string
+}
+
+// TransactionEntry is a single posted quantity movement. Entries are
+// append-only: corrections are posted as a new entry with a "_Reversal"
+// EntryType rather than mutating or deleting the original.
+type TransactionEntry struct {
+	ID              string
+	ParentID        string
+	ItemCode        string
+	Warehouse       string
+	DebitAccountID  string
+	CreditAccountID string
+	Amount          int64 // qty * QtyScale, to avoid float drift
+	InvoiceRef      string
+	EntryType       EntryType
+	CreatedAt       time.Time
+}
+
+// dedupeKey identifies the unique constraint
+// (ItemCode, Warehouse, InvoiceRef, DebitAccountID, CreditAccountID, EntryType)
+// that makes replayed stock events idempotent.
+func (e TransactionEntry) dedupeKey() string {
+	return fmt.Sprintf("%s|%s|%s|%s|%s|%s", e.ItemCode, e.Warehouse, e.InvoiceRef, e.DebitAccountID, e.CreditAccountID, e.EntryType)
+}
+
+// Bin is the projected quantity snapshot for an (ItemCode, Warehouse) pair,
+// computed by summing posted entries rather than stored as mutable scalars.
+type Bin struct {
+	ItemCode                     string
+	Warehouse                    string
+	ActualQty                    float64
+	OrderedQty                   float64
+	ReservedQty                  float64
+	IndentedQty                  float64
+	PlannedQty                   float64
+	ReservedQtyForProduction     float64
+	ReservedQtyForSubContract    float64
+	ReservedQtyForProductionPlan float64
+	ProjectedQty                 float64
+}
+
+// Service posts and projects TransactionEntry rows. The zero value is not
+// usable; construct with NewService.
+type Service struct {
+	mu      sync.Mutex
+	entries map[string]TransactionEntry
+	posted  map[string]struct{}
+}
+
+// NewService returns a ready-to-use in-memory ledger Service.
+func NewService() *Service {
+	return &Service{
+		entries: make(map[string]TransactionEntry),
+		posted:  make(map[string]struct{}),
+	}
+}
+
+// Post appends entry to the ledger. Posting the same
+// (ItemCode, Warehouse, InvoiceRef, DebitAccountID, CreditAccountID, EntryType)
+// tuple twice is a no-op: it returns nil without posting a duplicate, so
+// replayed stock events stay idempotent.
+func (s *Service) Post(entry TransactionEntry) error {
+	if entry.ID == "" {
+		return fmt.Errorf("ledger: entry ID is required")
+	}
+	if entry.ItemCode == "" || entry.Warehouse == "" {
+		return fmt.Errorf("ledger: entry for %s requires ItemCode and Warehouse", entry.ID)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := entry.dedupeKey()
+	if _, exists := s.posted[key]; exists {
+		return nil
+	}
+
+	s.posted[key] = struct{}{}
+	s.entries[entry.ID] = entry
+	return nil
+}
+
+// PostBatch posts every entry as a single unit, as updateQty does when it
+// translates one stock event into several typed entries: if any entry
+// fails validation, none of them are committed.
+func (s *Service) PostBatch(entries []TransactionEntry) error {
+	for _, e := range entries {
+		if e.ID == "" {
+			return fmt.Errorf("ledger: entry ID is required for %s/%s", e.ItemCode, e.Warehouse)
+		}
+		if e.ItemCode == "" || e.Warehouse == "" {
+			return fmt.Errorf("ledger: entry for %s requires ItemCode and Warehouse", e.ID)
+		}
+	}
+	for _, e := range entries {
+		if err := s.Post(e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Project sums all posted entries for itemCode/warehouse into a Bin-shaped
+// quantity snapshot, including the projected_qty arithmetic already used by
+// Bin.setProjectedQty.
+func (s *Service) Project(itemCode, warehouse string) (Bin, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	b := Bin{ItemCode: itemCode, Warehouse: warehouse}
+	for _, e := range s.entries {
+		if e.ItemCode != itemCode || e.Warehouse != warehouse {
+			continue
+		}
+		qty := float64(e.Amount) / QtyScale
+		switch e.EntryType {
+		case EntryTypeActual:
+			b.ActualQty += qty
+		case EntryTypeActualReversal:
+			b.ActualQty -= qty
+		case EntryTypeOrdered:
+			b.OrderedQty += qty
+		case EntryTypeOrderedReversal:
+			b.OrderedQty -= qty
+		case EntryTypeReserved:
+			b.ReservedQty += qty
+		case EntryTypeReservedReversal:
+			b.ReservedQty -= qty
+		case EntryTypeIndented:
+			b.IndentedQty += qty
+		case EntryTypeIndentedReversal:
+			b.IndentedQty -= qty
+		case EntryTypePlanned:
+			b.PlannedQty += qty
+		case EntryTypePlannedReversal:
+			b.PlannedQty -= qty
+		case EntryTypeReservedForProduction:
+			b.ReservedQtyForProduction += qty
+		case EntryTypeReservedForProductionReversal:
+			b.ReservedQtyForProduction -= qty
+		case EntryTypeReservedForSubContract:
+			b.ReservedQtyForSubContract += qty
+		case EntryTypeReservedForSubContractReversal:
+			b.ReservedQtyForSubContract -= qty
+		case EntryTypeReservedForProductionPlan:
+			b.ReservedQtyForProductionPlan += qty
+		case EntryTypeReservedForProductionPlanReversal:
+			b.ReservedQtyForProductionPlan -= qty
+		}
+	}
+
+	b.ProjectedQty = b.ActualQty + b.OrderedQty + b.IndentedQty + b.PlannedQty -
+		b.ReservedQty - b.ReservedQtyForProduction - b.ReservedQtyForSubContract - b.ReservedQtyForProductionPlan
+
+	return b, nil
+}
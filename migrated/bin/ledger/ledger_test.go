@@ -0,0 +1,104 @@
+package ledger
+
+import "testing"
+
+func TestPostAndProject(t *testing.T) {
+	svc := NewService()
+
+	err := svc.Post(TransactionEntry{
+		ID:              "e1",
+		ItemCode:        "item1",
+		Warehouse:       "warehouse1",
+		DebitAccountID:  "Bin.actual",
+		CreditAccountID: "StockMovement",
+		Amount:          100 * QtyScale,
+		InvoiceRef:      "SLE-1",
+		EntryType:       EntryTypeActual,
+	})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	bin, err := svc.Project("item1", "warehouse1")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if bin.ActualQty != 100 {
+		t.Errorf("expected ActualQty 100, got %f", bin.ActualQty)
+	}
+	if bin.ProjectedQty != 100 {
+		t.Errorf("expected ProjectedQty 100, got %f", bin.ProjectedQty)
+	}
+}
+
+func TestPostIsIdempotentOnDuplicateKey(t *testing.T) {
+	svc := NewService()
+	entry := TransactionEntry{
+		ID:              "e1",
+		ItemCode:        "item1",
+		Warehouse:       "warehouse1",
+		DebitAccountID:  "Bin.actual",
+		CreditAccountID: "StockMovement",
+		Amount:          100 * QtyScale,
+		InvoiceRef:      "SLE-1",
+		EntryType:       EntryTypeActual,
+	}
+
+	if err := svc.Post(entry); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	// Replay with a different entry ID but the same dedupe key: must be a
+	// no-op, not a double-post.
+	replay := entry
+	replay.ID = "e1-replay"
+	if err := svc.Post(replay); err != nil {
+		t.Fatalf("expected replay to be a no-op, got %v", err)
+	}
+
+	bin, _ := svc.Project("item1", "warehouse1")
+	if bin.ActualQty != 100 {
+		t.Errorf("expected replayed post to be ignored, ActualQty = %f", bin.ActualQty)
+	}
+}
+
+func TestReversalOffsetsOriginalEntry(t *testing.T) {
+	svc := NewService()
+
+	_ = svc.Post(TransactionEntry{
+		ID:              "reserve-1",
+		ItemCode:        "item1",
+		Warehouse:       "warehouse1",
+		DebitAccountID:  "Bin.reserved_for_production",
+		CreditAccountID: "StockMovement",
+		Amount:          40 * QtyScale,
+		InvoiceRef:      "WO-1",
+		EntryType:       EntryTypeReservedForProduction,
+	})
+	_ = svc.Post(TransactionEntry{
+		ID:              "reserve-1-reversal",
+		ItemCode:        "item1",
+		Warehouse:       "warehouse1",
+		DebitAccountID:  "Bin.reserved_for_production",
+		CreditAccountID: "StockMovement",
+		Amount:          40 * QtyScale,
+		InvoiceRef:      "WO-1",
+		EntryType:       EntryTypeReservedForProductionReversal,
+	})
+
+	bin, _ := svc.Project("item1", "warehouse1")
+	if bin.ReservedQtyForProduction != 0 {
+		t.Errorf("expected reversal to net to 0, got %f", bin.ReservedQtyForProduction)
+	}
+}
+
+func TestPostBatchRejectsEntryMissingID(t *testing.T) {
+	svc := NewService()
+	err := svc.PostBatch([]TransactionEntry{
+		{ID: "ok", ItemCode: "item1", Warehouse: "warehouse1", EntryType: EntryTypeActual},
+		{ItemCode: "item1", Warehouse: "warehouse1", EntryType: EntryTypeOrdered},
+	})
+	if err == nil {
+		t.Fatal("expected error for entry missing ID")
+	}
+}
@@ -1,20 +1,18 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"strings"
+
+	"github.com/GughanS/erpnext-ast-analyzer/domainerror"
 )
 
 // --- MANDATORY ERROR PATTERN ---
 
-type ValidationError struct {
-	Message string
-	Code    int
-	Err     error
-}
-
-func (e *ValidationError) Error() string { return e.Message }
-func (e *ValidationError) Unwrap() error { return e.Err }
+// ValidationError is an alias for domainerror.ValidationError, the shared
+// taxonomy member this package has always used under a local name.
+type ValidationError = domainerror.ValidationError
 
 // --- DATA STRUCTURES ---
 
@@ -41,6 +39,102 @@ type DBService interface {
 	// CheckPOSUsage checks if the given Mode of Payment is referenced by any active POS Profile.
 	// Returns a list of POS profile names if found.
 	CheckPOSUsage(mopName string) ([]string, error)
+
+	// GetExistingMOP fetches the persisted prior state of the named MOP, if
+	// any. The bool return is false for a document that hasn't been saved
+	// before, distinguishing "no prior state" from a zero-value MOP.
+	GetExistingMOP(name string) (*ModeofPayment, bool, error)
+
+	// GetAccountCompaniesBulk is the batched form of GetAccountCompany, used
+	// by ValidateBatch so a large import does one round trip instead of one
+	// per account. Accounts absent from the result map were not found.
+	GetAccountCompaniesBulk(accountNames []string) (map[string]string, error)
+
+	// CheckPOSUsageBulk is the batched form of CheckPOSUsage, used by
+	// ValidateBatch so a large import does one round trip instead of one
+	// per MOP. MOPs absent from the result map have no POS usage.
+	CheckPOSUsageBulk(mopNames []string) (map[string][]string, error)
+}
+
+// EventPublisher notifies downstream subscribers (search indexers, cache
+// invalidators, POS profile reloaders) that a ModeofPayment changed.
+type EventPublisher interface {
+	PublishMOPChanged(old, new *ModeofPayment, diff MOPDiff) error
+}
+
+// EnabledTransition describes how the Enabled flag moved between the
+// persisted and incoming document.
+type EnabledTransition int
+
+const (
+	EnabledUnchanged EnabledTransition = iota
+	EnabledFalseToTrue
+	EnabledTrueToFalse
+)
+
+// MOPDiff enumerates what changed between the persisted prior state of a
+// ModeofPayment and the incoming document. Account rows are matched by
+// Company, since a company may only be linked to one default account at a
+// time.
+type MOPDiff struct {
+	AddedAccounts     []ModeofPaymentAccount
+	RemovedAccounts   []ModeofPaymentAccount
+	ModifiedAccounts  []ModeofPaymentAccount // new row for a Company whose DefaultAccount changed
+	EnabledTransition EnabledTransition
+}
+
+// IsEmpty reports whether nothing changed, meaning Validate should skip
+// publication and return ErrNoChange.
+func (d MOPDiff) IsEmpty() bool {
+	return len(d.AddedAccounts) == 0 && len(d.RemovedAccounts) == 0 &&
+		len(d.ModifiedAccounts) == 0 && d.EnabledTransition == EnabledUnchanged
+}
+
+// ErrNoChange is returned by ModeofPaymentService.Validate when the incoming
+// document is identical to its persisted prior state: validation passed but
+// there is nothing for subscribers to react to.
+var ErrNoChange = errors.New("modeofpayment: no change from persisted state")
+
+// computeMOPDiff compares the persisted prior state (nil for a document
+// being saved for the first time) against the incoming document.
+func computeMOPDiff(old, new *ModeofPayment) MOPDiff {
+	var diff MOPDiff
+
+	oldByCompany := make(map[string]ModeofPaymentAccount)
+	if old != nil {
+		for _, a := range old.Accounts {
+			oldByCompany[a.Company] = a
+		}
+	}
+	newByCompany := make(map[string]ModeofPaymentAccount)
+	for _, a := range new.Accounts {
+		newByCompany[a.Company] = a
+	}
+
+	for company, newAccount := range newByCompany {
+		oldAccount, existed := oldByCompany[company]
+		switch {
+		case !existed:
+			diff.AddedAccounts = append(diff.AddedAccounts, newAccount)
+		case oldAccount.DefaultAccount != newAccount.DefaultAccount:
+			diff.ModifiedAccounts = append(diff.ModifiedAccounts, newAccount)
+		}
+	}
+	for company, oldAccount := range oldByCompany {
+		if _, stillPresent := newByCompany[company]; !stillPresent {
+			diff.RemovedAccounts = append(diff.RemovedAccounts, oldAccount)
+		}
+	}
+
+	if old != nil && old.Enabled != new.Enabled {
+		if new.Enabled {
+			diff.EnabledTransition = EnabledFalseToTrue
+		} else {
+			diff.EnabledTransition = EnabledTrueToFalse
+		}
+	}
+
+	return diff
 }
 
 // --- BUSINESS LOGIC IMPLEMENTATION (ModeofPayment) ---
@@ -52,8 +146,8 @@ func validateRepeatingCompanies(mop *ModeofPayment) error {
 	for _, entry := range mop.Accounts {
 		if _, found := seen[entry.Company]; found {
 			return &ValidationError{
-				Message: "Same Company is entered more than once",
-				Code:    409,
+				Message:    "Same Company is entered more than once",
+				StatusCode: 409,
 			}
 		}
 		seen[entry.Company] = struct{}{}
@@ -78,8 +172,8 @@ func validateAccounts(mop *ModeofPayment, db DBService) error {
 				entry.DefaultAccount, entry.Company, mop.ModeOfPaymentName)
 
 			return &ValidationError{
-				Message: msg,
-				Code:    400,
+				Message:    msg,
+				StatusCode: 400,
 			}
 		}
 	}
@@ -109,8 +203,8 @@ func validatePOSModeOfPayment(mop *ModeofPayment, db DBService) error {
 		)
 
 		return &ValidationError{
-			Message: message,
-			Code:    403, // Not Allowed
+			Message:    message,
+			StatusCode: 403, // Not Allowed
 		}
 	}
 	return nil
@@ -120,10 +214,15 @@ func validatePOSModeOfPayment(mop *ModeofPayment, db DBService) error {
 
 // ModeofPaymentService orchestrates the document validation process.
 type ModeofPaymentService struct {
-	DB DBService
+	DB        DBService
+	Publisher EventPublisher
 }
 
-// Validate executes all business rule checks defined for the ModeofPayment document.
+// Validate executes all business rule checks defined for the ModeofPayment
+// document, then diffs it against its persisted prior state and publishes a
+// change event. If the diff is empty -- an idempotent save attempt, as
+// happens when MOP saves are triggered by background reconciliation loops --
+// publication is skipped entirely and Validate returns ErrNoChange.
 func (v *ModeofPaymentService) Validate(mop *ModeofPayment) error {
 	// 1. Validate repeating companies
 	if err := validateRepeatingCompanies(mop); err != nil {
@@ -140,5 +239,198 @@ func (v *ModeofPaymentService) Validate(mop *ModeofPayment) error {
 		return err
 	}
 
+	// 4. Diff against persisted prior state and publish only on real change.
+	existing, found, err := v.DB.GetExistingMOP(mop.ModeOfPaymentName)
+	if err != nil {
+		return fmt.Errorf("modeofpayment validation: failed to load existing state for %s: %w", mop.ModeOfPaymentName, err)
+	}
+
+	diff := computeMOPDiff(existing, mop)
+	if found && diff.IsEmpty() {
+		return ErrNoChange
+	}
+
+	if v.Publisher != nil {
+		if err := v.Publisher.PublishMOPChanged(existing, mop, diff); err != nil {
+			return fmt.Errorf("modeofpayment validation: failed to publish change event for %s: %w", mop.ModeOfPaymentName, err)
+		}
+	}
+
+	return nil
+}
+
+// MOPOutcome is the per-MOP result of a ValidateBatch call.
+type MOPOutcome struct {
+	ModeOfPaymentName string
+	Success           bool
+	ValidationErr     *ValidationError // set when Success is false due to a business rule violation
+	DBErr             error            // set when Success is false due to a wrapped DB error
+	Diff              MOPDiff          // what would change if this row were persisted
+	Changed           bool             // false means this row is a no-op and can be skipped
+}
+
+// BatchResult aggregates the outcome of validating many ModeofPayment
+// documents in one ValidateBatch call.
+type BatchResult struct {
+	Outcomes             []MOPOutcome
+	SuccessCount         int
+	ChangedCount         int
+	NoChangeCount        int
+	ValidationErrorCount int
+	DBErrorCount         int
+}
+
+// ValidateBatch validates many MOPs in one call, batching the
+// GetAccountCompany and CheckPOSUsage round trips so those checks take 2 DB
+// calls for the whole batch instead of one or more per MOP. The persisted
+// prior state behind each row's MOPDiff is still loaded with one
+// GetExistingMOP call per MOP that passes every check. The existing per-MOP precedence order
+// (repeating companies -> accounts -> POS usage) is preserved; a MOP that
+// fails an earlier check is excluded from later bulk lookups. ValidateBatch
+// only reports what would change per row (see MOPDiff) -- it does not
+// publish change events, so an importer can skip no-op rows before writing
+// or publishing anything.
+func (v *ModeofPaymentService) ValidateBatch(mops []*ModeofPayment) BatchResult {
+	result := BatchResult{Outcomes: make([]MOPOutcome, 0, len(mops))}
+
+	survivingRepeats := make([]*ModeofPayment, 0, len(mops))
+	for _, mop := range mops {
+		if err := validateRepeatingCompanies(mop); err != nil {
+			result.addOutcome(mopFailure(mop, err))
+			continue
+		}
+		survivingRepeats = append(survivingRepeats, mop)
+	}
+
+	accountNames := make([]string, 0, len(survivingRepeats))
+	for _, mop := range survivingRepeats {
+		for _, entry := range mop.Accounts {
+			accountNames = append(accountNames, entry.DefaultAccount)
+		}
+	}
+	companiesByAccount, bulkErr := v.DB.GetAccountCompaniesBulk(accountNames)
+
+	survivingAccounts := make([]*ModeofPayment, 0, len(survivingRepeats))
+	for _, mop := range survivingRepeats {
+		if bulkErr != nil {
+			result.addOutcome(mopFailure(mop, fmt.Errorf("modeofpayment validation: bulk account lookup failed: %w", bulkErr)))
+			continue
+		}
+		if err := validateAccountsBulk(mop, companiesByAccount); err != nil {
+			result.addOutcome(mopFailure(mop, err))
+			continue
+		}
+		survivingAccounts = append(survivingAccounts, mop)
+	}
+
+	mopNames := make([]string, 0, len(survivingAccounts))
+	for _, mop := range survivingAccounts {
+		mopNames = append(mopNames, mop.ModeOfPaymentName)
+	}
+	posUsageByMOP, bulkPOSErr := v.DB.CheckPOSUsageBulk(mopNames)
+
+	for _, mop := range survivingAccounts {
+		if bulkPOSErr != nil {
+			result.addOutcome(mopFailure(mop, fmt.Errorf("modeofpayment validation: bulk POS usage check failed: %w", bulkPOSErr)))
+			continue
+		}
+		if err := validatePOSModeOfPaymentBulk(mop, posUsageByMOP); err != nil {
+			result.addOutcome(mopFailure(mop, err))
+			continue
+		}
+
+		existing, found, err := v.DB.GetExistingMOP(mop.ModeOfPaymentName)
+		if err != nil {
+			result.addOutcome(mopFailure(mop, fmt.Errorf("modeofpayment validation: failed to load existing state for %s: %w", mop.ModeOfPaymentName, err)))
+			continue
+		}
+
+		diff := computeMOPDiff(existing, mop)
+		result.addOutcome(MOPOutcome{
+			ModeOfPaymentName: mop.ModeOfPaymentName,
+			Success:           true,
+			Diff:              diff,
+			Changed:           !(found && diff.IsEmpty()),
+		})
+	}
+
+	return result
+}
+
+// mopFailure builds the MOPOutcome for a validation/DB failure, classifying
+// err as a ValidationError or a wrapped DB error.
+func mopFailure(mop *ModeofPayment, err error) MOPOutcome {
+	outcome := MOPOutcome{ModeOfPaymentName: mop.ModeOfPaymentName}
+	var vErr *ValidationError
+	if errors.As(err, &vErr) {
+		outcome.ValidationErr = vErr
+	} else {
+		outcome.DBErr = err
+	}
+	return outcome
+}
+
+// addOutcome records outcome and updates BatchResult's aggregate counters.
+func (r *BatchResult) addOutcome(outcome MOPOutcome) {
+	r.Outcomes = append(r.Outcomes, outcome)
+	switch {
+	case outcome.ValidationErr != nil:
+		r.ValidationErrorCount++
+	case outcome.DBErr != nil:
+		r.DBErrorCount++
+	default:
+		r.SuccessCount++
+		if outcome.Changed {
+			r.ChangedCount++
+		} else {
+			r.NoChangeCount++
+		}
+	}
+}
+
+// validateAccountsBulk is the bulk-lookup form of validateAccounts: it
+// checks each account against a pre-fetched company map instead of making a
+// DB call per account.
+func validateAccountsBulk(mop *ModeofPayment, companiesByAccount map[string]string) error {
+	for _, entry := range mop.Accounts {
+		ledgerCompany, ok := companiesByAccount[entry.DefaultAccount]
+		if !ok {
+			return fmt.Errorf("modeofpayment validation: account %s not found in bulk lookup", entry.DefaultAccount)
+		}
+
+		if ledgerCompany != entry.Company {
+			msg := fmt.Sprintf("Account %s does not match with Company %s in Mode of Account: %s",
+				entry.DefaultAccount, entry.Company, mop.ModeOfPaymentName)
+
+			return &ValidationError{
+				Message:    msg,
+				StatusCode: 400,
+			}
+		}
+	}
+	return nil
+}
+
+// validatePOSModeOfPaymentBulk is the bulk-lookup form of
+// validatePOSModeOfPayment: it checks POS usage against a pre-fetched map
+// instead of making a DB call per MOP.
+func validatePOSModeOfPaymentBulk(mop *ModeofPayment, posUsageByMOP map[string][]string) error {
+	if mop.Enabled {
+		return nil
+	}
+
+	posProfiles := posUsageByMOP[mop.ModeOfPaymentName]
+	if len(posProfiles) > 0 {
+		message := fmt.Sprintf(
+			"POS Profile %s contains Mode of Payment %s. Please remove them to disable this mode.",
+			strings.Join(posProfiles, ", "),
+			mop.ModeOfPaymentName,
+		)
+
+		return &ValidationError{
+			Message:    message,
+			StatusCode: 403,
+		}
+	}
 	return nil
-}
\ No newline at end of file
+}
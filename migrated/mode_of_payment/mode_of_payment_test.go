@@ -5,21 +5,118 @@ import (
 	"fmt"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
 
 // --- MOCK IMPLEMENTATION ---
 
+// Sentinel inputs that deterministically trigger a specific scripted outcome
+// from MockDBService, without the test having to pre-populate maps. This
+// lets a single test exercise partial failures (e.g. account #2 of 5 fails)
+// by simply naming the account/MOP it wants to misbehave.
+const (
+	MockAccountNotFound            = "__mock_account_not_found__"
+	MockAccountDBTimeout           = "__mock_account_db_timeout__"
+	MockAccountReturnsWrongCompany = "__mock_account_wrong_company__"
+	MockPOSCheckReturnsHugeList    = "__mock_pos_huge_list__"
+	MockPOSCheckPanicThenRecover   = "__mock_pos_panic_then_recover__"
+)
+
+// MockCall records one invocation of a MockDBService method, so integration
+// tests can assert that ModeofPaymentService.Validate short-circuits on the
+// first failure in the precedence order (repeating -> accounts -> POS) and
+// makes no further DB calls.
+type MockCall struct {
+	Method string
+	Arg    string
+}
+
 // MockDBService is a mock implementation of DBService for testing.
 type MockDBService struct {
 	AccountCompanyMap    map[string]string
 	POSUsage             map[string][]string
 	ErrorOnAccountLookup error
 	ErrorOnPOSCheck      error
+	ExistingMOPs         map[string]*ModeofPayment
+	ErrorOnExistingMOP   error
+
+	// DBTimeoutDelay is how long GetAccountCompany sleeps before returning
+	// for MockAccountDBTimeout. Defaults to a few milliseconds if unset, so
+	// tests don't have to wait on a realistic timeout to exercise the path.
+	DBTimeoutDelay time.Duration
+	// HugeListSize is how many POS profile names CheckPOSUsage returns for
+	// MockPOSCheckReturnsHugeList. Defaults to 10000 if unset.
+	HugeListSize int
+
+	Calls []MockCall
+}
+
+func (m *MockDBService) GetExistingMOP(name string) (*ModeofPayment, bool, error) {
+	if m.ErrorOnExistingMOP != nil {
+		return nil, false, m.ErrorOnExistingMOP
+	}
+	existing, ok := m.ExistingMOPs[name]
+	return existing, ok, nil
+}
+
+func (m *MockDBService) GetAccountCompaniesBulk(accountNames []string) (map[string]string, error) {
+	if m.ErrorOnAccountLookup != nil {
+		return nil, m.ErrorOnAccountLookup
+	}
+	result := make(map[string]string, len(accountNames))
+	for _, name := range accountNames {
+		if company, ok := m.AccountCompanyMap[name]; ok {
+			result[name] = company
+		}
+	}
+	return result, nil
+}
+
+func (m *MockDBService) CheckPOSUsageBulk(mopNames []string) (map[string][]string, error) {
+	if m.ErrorOnPOSCheck != nil {
+		return nil, m.ErrorOnPOSCheck
+	}
+	result := make(map[string][]string, len(mopNames))
+	for _, name := range mopNames {
+		if profiles, ok := m.POSUsage[name]; ok {
+			result[name] = profiles
+		}
+	}
+	return result, nil
+}
+
+// MockEventPublisher records every PublishMOPChanged call for assertions.
+type MockEventPublisher struct {
+	Calls          int
+	LastDiff       MOPDiff
+	ErrorOnPublish error
+}
+
+func (m *MockEventPublisher) PublishMOPChanged(old, new *ModeofPayment, diff MOPDiff) error {
+	m.Calls++
+	m.LastDiff = diff
+	return m.ErrorOnPublish
 }
 
 func (m *MockDBService) GetAccountCompany(accountName string) (string, error) {
+	m.Calls = append(m.Calls, MockCall{Method: "GetAccountCompany", Arg: accountName})
+
+	switch accountName {
+	case MockAccountNotFound:
+		return "", fmt.Errorf("account %s not found in mock cache", accountName)
+	case MockAccountDBTimeout:
+		delay := m.DBTimeoutDelay
+		if delay == 0 {
+			delay = 5 * time.Millisecond
+		}
+		time.Sleep(delay)
+		return "", fmt.Errorf("account %s: db timeout", accountName)
+	case MockAccountReturnsWrongCompany:
+		return "__mock_wrong_company__", nil
+	}
+
 	if m.ErrorOnAccountLookup != nil {
 		return "", m.ErrorOnAccountLookup
 	}
@@ -33,6 +130,23 @@ func (m *MockDBService) GetAccountCompany(accountName string) (string, error) {
 }
 
 func (m *MockDBService) CheckPOSUsage(mopName string) ([]string, error) {
+	m.Calls = append(m.Calls, MockCall{Method: "CheckPOSUsage", Arg: mopName})
+
+	switch mopName {
+	case MockPOSCheckReturnsHugeList:
+		size := m.HugeListSize
+		if size == 0 {
+			size = 10000
+		}
+		profiles := make([]string, size)
+		for i := range profiles {
+			profiles[i] = fmt.Sprintf("POS Profile %d", i)
+		}
+		return profiles, nil
+	case MockPOSCheckPanicThenRecover:
+		return m.checkPOSUsagePanicRecovered(mopName)
+	}
+
 	if m.ErrorOnPOSCheck != nil {
 		return nil, m.ErrorOnPOSCheck
 	}
@@ -43,6 +157,18 @@ func (m *MockDBService) CheckPOSUsage(mopName string) ([]string, error) {
 	return profiles, nil
 }
 
+// checkPOSUsagePanicRecovered simulates a transient failure in the POS
+// usage lookup (e.g. a driver-level panic) that the DB layer recovers from
+// and surfaces as a plain error, rather than crashing the caller.
+func (m *MockDBService) checkPOSUsagePanicRecovered(mopName string) (profiles []string, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("mock pos usage check for %s: recovered from panic: %v", mopName, r)
+		}
+	}()
+	panic("simulated transient POS usage lookup failure")
+}
+
 // --- TEST SUITE ---
 
 func TestValidateRepeatingCompanies(t *testing.T) {
@@ -70,7 +196,7 @@ func TestValidateRepeatingCompanies(t *testing.T) {
 
 		var vErr *ValidationError
 		assert.True(t, errors.As(err, &vErr))
-		assert.Equal(t, 409, vErr.Code)
+		assert.Equal(t, 409, vErr.StatusCode)
 		assert.Contains(t, vErr.Message, "Same Company is entered more than once")
 	})
 
@@ -111,7 +237,7 @@ func TestValidateAccounts(t *testing.T) {
 
 		var vErr *ValidationError
 		assert.True(t, errors.As(err, &vErr))
-		assert.Equal(t, 400, vErr.Code)
+		assert.Equal(t, 400, vErr.StatusCode)
 		assert.Contains(t, vErr.Message, "Account ACC_USD does not match with Company WRONG Corp")
 		assert.Contains(t, vErr.Message, "MismatchMOP")
 	})
@@ -166,7 +292,7 @@ func TestValidatePOSModeOfPayment(t *testing.T) {
 
 		var vErr *ValidationError
 		assert.True(t, errors.As(err, &vErr))
-		assert.Equal(t, 403, vErr.Code)
+		assert.Equal(t, 403, vErr.StatusCode)
 		assert.Contains(t, vErr.Message, "POS Profile Profile A contains Mode of Payment GiftCard")
 	})
 
@@ -180,7 +306,7 @@ func TestValidatePOSModeOfPayment(t *testing.T) {
 
 		var vErr *ValidationError
 		assert.True(t, errors.As(err, &vErr))
-		assert.Equal(t, 403, vErr.Code)
+		assert.Equal(t, 403, vErr.StatusCode)
 		assert.Contains(t, vErr.Message, "POS Profile Profile X, Profile Y, Profile Z contains Mode of Payment GiftCard")
 	})
 
@@ -238,7 +364,7 @@ func TestModeofPaymentService_Validate(t *testing.T) {
 		err := service.Validate(mop)
 		var vErr *ValidationError
 		assert.True(t, errors.As(err, &vErr))
-		assert.Equal(t, 409, vErr.Code)
+		assert.Equal(t, 409, vErr.StatusCode)
 	})
 
 	// 3. Failure Order Test 2: Account Mismatch (Mid Precedence)
@@ -254,7 +380,7 @@ func TestModeofPaymentService_Validate(t *testing.T) {
 		err := service.Validate(mop)
 		var vErr *ValidationError
 		assert.True(t, errors.As(err, &vErr))
-		assert.Equal(t, 400, vErr.Code)
+		assert.Equal(t, 400, vErr.StatusCode)
 	})
 
 	// 4. Failure Order Test 3: POS Usage Conflict (Lowest Precedence)
@@ -275,6 +401,272 @@ func TestModeofPaymentService_Validate(t *testing.T) {
 		err := conflictService.Validate(mop)
 		var vErr *ValidationError
 		assert.True(t, errors.As(err, &vErr))
-		assert.Equal(t, 403, vErr.Code)
+		assert.Equal(t, 403, vErr.StatusCode)
+	})
+}
+
+func TestModeofPaymentService_ChangeDetection(t *testing.T) {
+	accountCompanyMap := map[string]string{
+		"ACC_OK_1": "C1",
+		"ACC_OK_2": "C2",
+	}
+
+	t.Run("NoChange_SkipsPublishAndReturnsErrNoChange", func(t *testing.T) {
+		mop := &ModeofPayment{
+			ModeOfPaymentName: "MOP_STABLE",
+			Enabled:           true,
+			Accounts: []ModeofPaymentAccount{
+				{Company: "C1", DefaultAccount: "ACC_OK_1"},
+			},
+		}
+		publisher := &MockEventPublisher{}
+		service := &ModeofPaymentService{
+			DB: &MockDBService{
+				AccountCompanyMap: accountCompanyMap,
+				ExistingMOPs:      map[string]*ModeofPayment{"MOP_STABLE": mop},
+			},
+			Publisher: publisher,
+		}
+
+		err := service.Validate(mop)
+		assert.True(t, errors.Is(err, ErrNoChange))
+		assert.Equal(t, 0, publisher.Calls)
 	})
+
+	t.Run("AccountAdded_Publishes", func(t *testing.T) {
+		existing := &ModeofPayment{
+			ModeOfPaymentName: "MOP_GROWING",
+			Enabled:           true,
+			Accounts: []ModeofPaymentAccount{
+				{Company: "C1", DefaultAccount: "ACC_OK_1"},
+			},
+		}
+		incoming := &ModeofPayment{
+			ModeOfPaymentName: "MOP_GROWING",
+			Enabled:           true,
+			Accounts: []ModeofPaymentAccount{
+				{Company: "C1", DefaultAccount: "ACC_OK_1"},
+				{Company: "C2", DefaultAccount: "ACC_OK_2"},
+			},
+		}
+		publisher := &MockEventPublisher{}
+		service := &ModeofPaymentService{
+			DB: &MockDBService{
+				AccountCompanyMap: accountCompanyMap,
+				ExistingMOPs:      map[string]*ModeofPayment{"MOP_GROWING": existing},
+			},
+			Publisher: publisher,
+		}
+
+		err := service.Validate(incoming)
+		assert.NoError(t, err)
+		assert.Equal(t, 1, publisher.Calls)
+		assert.Len(t, publisher.LastDiff.AddedAccounts, 1)
+		assert.Equal(t, "C2", publisher.LastDiff.AddedAccounts[0].Company)
+	})
+
+	t.Run("EnabledToggled_FlagsTransition", func(t *testing.T) {
+		existing := &ModeofPayment{ModeOfPaymentName: "MOP_TOGGLE", Enabled: false}
+		incoming := &ModeofPayment{ModeOfPaymentName: "MOP_TOGGLE", Enabled: true}
+		publisher := &MockEventPublisher{}
+		service := &ModeofPaymentService{
+			DB: &MockDBService{
+				ExistingMOPs: map[string]*ModeofPayment{"MOP_TOGGLE": existing},
+			},
+			Publisher: publisher,
+		}
+
+		err := service.Validate(incoming)
+		assert.NoError(t, err)
+		assert.Equal(t, EnabledFalseToTrue, publisher.LastDiff.EnabledTransition)
+	})
+
+	t.Run("NewDocument_PublishesWithoutErrNoChange", func(t *testing.T) {
+		mop := &ModeofPayment{
+			ModeOfPaymentName: "MOP_NEW",
+			Enabled:           true,
+			Accounts: []ModeofPaymentAccount{
+				{Company: "C1", DefaultAccount: "ACC_OK_1"},
+			},
+		}
+		publisher := &MockEventPublisher{}
+		service := &ModeofPaymentService{
+			DB: &MockDBService{
+				AccountCompanyMap: accountCompanyMap,
+			},
+			Publisher: publisher,
+		}
+
+		err := service.Validate(mop)
+		assert.NoError(t, err)
+		assert.Equal(t, 1, publisher.Calls)
+	})
+}
+
+func TestMockDBService_SentinelValues(t *testing.T) {
+	t.Run("MockAccountNotFound", func(t *testing.T) {
+		mockDB := &MockDBService{}
+		_, err := mockDB.GetAccountCompany(MockAccountNotFound)
+		assert.Error(t, err)
+	})
+
+	t.Run("MockAccountDBTimeout", func(t *testing.T) {
+		mockDB := &MockDBService{DBTimeoutDelay: time.Millisecond}
+		start := time.Now()
+		_, err := mockDB.GetAccountCompany(MockAccountDBTimeout)
+		assert.Error(t, err)
+		assert.GreaterOrEqual(t, time.Since(start), time.Millisecond)
+	})
+
+	t.Run("MockAccountReturnsWrongCompany", func(t *testing.T) {
+		mockDB := &MockDBService{}
+		company, err := mockDB.GetAccountCompany(MockAccountReturnsWrongCompany)
+		assert.NoError(t, err)
+		assert.NotEmpty(t, company)
+	})
+
+	t.Run("MockPOSCheckReturnsHugeList", func(t *testing.T) {
+		mockDB := &MockDBService{HugeListSize: 50}
+		profiles, err := mockDB.CheckPOSUsage(MockPOSCheckReturnsHugeList)
+		assert.NoError(t, err)
+		assert.Len(t, profiles, 50)
+	})
+
+	t.Run("MockPOSCheckPanicThenRecover", func(t *testing.T) {
+		mockDB := &MockDBService{}
+		_, err := mockDB.CheckPOSUsage(MockPOSCheckPanicThenRecover)
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "recovered from panic")
+	})
+}
+
+func TestModeofPaymentService_ValidateShortCircuitsOnFirstFailure(t *testing.T) {
+	t.Run("RepeatingCompanies_StopsBeforeAnyDBCall", func(t *testing.T) {
+		mockDB := &MockDBService{}
+		service := &ModeofPaymentService{DB: mockDB}
+
+		mop := &ModeofPayment{
+			ModeOfPaymentName: "MOP_DUP",
+			Accounts: []ModeofPaymentAccount{
+				{Company: "C1", DefaultAccount: "ACC_1"},
+				{Company: "C1", DefaultAccount: "ACC_2"},
+			},
+		}
+
+		err := service.Validate(mop)
+		assert.Error(t, err)
+		assert.Empty(t, mockDB.Calls)
+	})
+
+	t.Run("AccountMismatch_StopsBeforePOSCheck", func(t *testing.T) {
+		mockDB := &MockDBService{
+			AccountCompanyMap: map[string]string{"ACC_1": "C1"},
+		}
+		service := &ModeofPaymentService{DB: mockDB}
+
+		mop := &ModeofPayment{
+			ModeOfPaymentName: "MOP_MISMATCH",
+			Enabled:           false,
+			Accounts: []ModeofPaymentAccount{
+				{Company: "WRONG", DefaultAccount: "ACC_1"},
+			},
+		}
+
+		err := service.Validate(mop)
+		assert.Error(t, err)
+
+		for _, call := range mockDB.Calls {
+			assert.NotEqual(t, "CheckPOSUsage", call.Method)
+		}
+	})
+}
+
+func TestModeofPaymentService_ValidateBatch(t *testing.T) {
+	mockDB := &MockDBService{
+		AccountCompanyMap: map[string]string{
+			"ACC_OK_1": "C1",
+			"ACC_OK_2": "C2",
+		},
+		POSUsage: map[string][]string{"MOP_BLOCKED": {"P_Retail"}},
+		ExistingMOPs: map[string]*ModeofPayment{
+			"MOP_UNCHANGED": {
+				ModeOfPaymentName: "MOP_UNCHANGED",
+				Enabled:           true,
+				Accounts:          []ModeofPaymentAccount{{Company: "C1", DefaultAccount: "ACC_OK_1"}},
+			},
+		},
+	}
+	service := &ModeofPaymentService{DB: mockDB}
+
+	mops := []*ModeofPayment{
+		{
+			ModeOfPaymentName: "MOP_DUP",
+			Accounts: []ModeofPaymentAccount{
+				{Company: "C1", DefaultAccount: "ACC_OK_1"},
+				{Company: "C1", DefaultAccount: "ACC_OK_2"},
+			},
+		},
+		{
+			ModeOfPaymentName: "MOP_MISMATCH",
+			Accounts:          []ModeofPaymentAccount{{Company: "WRONG", DefaultAccount: "ACC_OK_1"}},
+		},
+		{
+			ModeOfPaymentName: "MOP_BLOCKED",
+			Enabled:           false,
+			Accounts:          []ModeofPaymentAccount{{Company: "C1", DefaultAccount: "ACC_OK_1"}},
+		},
+		{
+			ModeOfPaymentName: "MOP_UNCHANGED",
+			Enabled:           true,
+			Accounts:          []ModeofPaymentAccount{{Company: "C1", DefaultAccount: "ACC_OK_1"}},
+		},
+		{
+			ModeOfPaymentName: "MOP_NEW",
+			Enabled:           true,
+			Accounts:          []ModeofPaymentAccount{{Company: "C2", DefaultAccount: "ACC_OK_2"}},
+		},
+	}
+
+	result := service.ValidateBatch(mops)
+
+	assert.Equal(t, 5, len(result.Outcomes))
+	// MOP_DUP fails repeating companies, MOP_MISMATCH fails account/company
+	// consistency, and MOP_BLOCKED fails the POS usage check.
+	assert.Equal(t, 3, result.ValidationErrorCount)
+	assert.Equal(t, 2, result.SuccessCount) // MOP_UNCHANGED, MOP_NEW
+	assert.Equal(t, 1, result.NoChangeCount)
+	assert.Equal(t, 1, result.ChangedCount)
+
+	byName := make(map[string]MOPOutcome)
+	for _, o := range result.Outcomes {
+		byName[o.ModeOfPaymentName] = o
+	}
+
+	assert.NotNil(t, byName["MOP_DUP"].ValidationErr)
+	assert.Equal(t, 409, byName["MOP_DUP"].ValidationErr.StatusCode)
+
+	assert.NotNil(t, byName["MOP_MISMATCH"].ValidationErr)
+	assert.Equal(t, 400, byName["MOP_MISMATCH"].ValidationErr.StatusCode)
+
+	assert.NotNil(t, byName["MOP_BLOCKED"].ValidationErr)
+	assert.Equal(t, 403, byName["MOP_BLOCKED"].ValidationErr.StatusCode)
+
+	assert.True(t, byName["MOP_UNCHANGED"].Success)
+	assert.False(t, byName["MOP_UNCHANGED"].Changed)
+
+	assert.True(t, byName["MOP_NEW"].Success)
+	assert.True(t, byName["MOP_NEW"].Changed)
+}
+
+func TestModeofPaymentService_ValidateBatch_BulkAccountLookupFailure(t *testing.T) {
+	mockDB := &MockDBService{ErrorOnAccountLookup: errors.New("bulk lookup unavailable")}
+	service := &ModeofPaymentService{DB: mockDB}
+
+	mops := []*ModeofPayment{
+		{ModeOfPaymentName: "MOP_1", Accounts: []ModeofPaymentAccount{{Company: "C1", DefaultAccount: "ACC_1"}}},
+	}
+
+	result := service.ValidateBatch(mops)
+	assert.Equal(t, 1, result.DBErrorCount)
+	assert.Error(t, result.Outcomes[0].DBErr)
 }
\ No newline at end of file
@@ -0,0 +1,222 @@
+// Package allocation implements a reserve/commit/reverse lifecycle for
+// MonthlyDistribution allocations, mirroring the double-entry ledger
+// pattern used for Bin quantities: an allocation is never overwritten in
+// place, it is posted as an AllocationEntry, and "how much of this month's
+// budget is reserved/committed/available" becomes a projection over the
+// entries posted so far.
+package allocation
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/GughanS/erpnext-ast-analyzer/clock"
+)
+
+// EntryType identifies the lifecycle stage of an AllocationEntry.
+type EntryType string
+
+const (
+	// AllocationReserve holds budget against a month without actualizing it.
+	AllocationReserve EntryType = "reserve"
+	// AllocationCommit actualizes a reserved amount.
+	AllocationCommit EntryType = "commit"
+	// AllocationReserveReversal releases a reservation, in full (Reverse) or
+	// for the unused remainder once it has been committed (Commit).
+	AllocationReserveReversal EntryType = "reserve_reversal"
+)
+
+// AllocationEntry is a single posted movement against a MonthlyDistribution
+// month. ParentID links a Commit or ReserveReversal entry back to the
+// Reserve entry it resolves; it is empty on the Reserve entry itself.
+type AllocationEntry struct {
+	ID             string
+	ParentID       string
+	DistributionID string
+	Month          string
+	Amount         float64
+	EntryType      EntryType
+	CreatedAt      time.Time
+}
+
+// dedupeKey identifies the unique constraint
+// (DistributionID, Month, ParentID, EntryType) that makes retried
+// Reserve/Commit/Reverse calls idempotent: only one reservation per
+// (DistributionID, Month) is ever posted, even after it has been committed
+// or reversed, and each reserve entry can be committed or reversed exactly
+// once.
+func (e AllocationEntry) dedupeKey() string {
+	return fmt.Sprintf("%s|%s|%s|%s", e.DistributionID, e.Month, e.ParentID, e.EntryType)
+}
+
+// PeriodAllocation is the projected reserve/commit/available state for a
+// single period, summed from posted AllocationEntry rows.
+type PeriodAllocation struct {
+	Reserved  float64
+	Committed float64
+	Available float64
+}
+
+// Service posts and projects AllocationEntry rows. The zero value is not
+// usable; construct with NewService or NewServiceWithClock.
+type Service struct {
+	mu      sync.Mutex
+	entries map[string]AllocationEntry
+	posted  map[string]struct{}
+	clock   clock.Clock
+}
+
+// NewService returns a ready-to-use in-memory allocation Service backed by
+// the real wall clock.
+func NewService() *Service {
+	return NewServiceWithClock(clock.RealClock{})
+}
+
+// NewServiceWithClock returns an allocation Service whose posted entries are
+// stamped from c, so tests can pin CreatedAt to a fixed instant instead of
+// depending on time.Now() drift.
+func NewServiceWithClock(c clock.Clock) *Service {
+	return &Service{
+		entries: make(map[string]AllocationEntry),
+		posted:  make(map[string]struct{}),
+		clock:   c,
+	}
+}
+
+// Reserve holds amount against distributionID's month. Retrying with the
+// same distributionID/month is idempotent: it returns the entry ID of the
+// existing reservation rather than posting a second one.
+func (s *Service) Reserve(distributionID, month string, amount float64) (string, error) {
+	id := fmt.Sprintf("%s|%s|reserve", distributionID, month)
+	entry := AllocationEntry{
+		ID:             id,
+		DistributionID: distributionID,
+		Month:          month,
+		Amount:         amount,
+		EntryType:      AllocationReserve,
+		CreatedAt:      s.clock.Now(),
+	}
+	if err := s.post(entry); err != nil {
+		return "", err
+	}
+	return id, nil
+}
+
+// Commit actualizes a reservation. It posts a Commit entry for actualAmount
+// and, if actualAmount is less than what was reserved, an offsetting
+// AllocationReserveReversal for the unused remainder.
+func (s *Service) Commit(reserveEntryID string, actualAmount float64) error {
+	reserve, ok := s.get(reserveEntryID)
+	if !ok {
+		return fmt.Errorf("allocation: no reserve entry %s", reserveEntryID)
+	}
+	if reserve.EntryType != AllocationReserve {
+		return fmt.Errorf("allocation: entry %s is not a reservation", reserveEntryID)
+	}
+
+	commit := AllocationEntry{
+		ID:             reserveEntryID + "|commit",
+		ParentID:       reserveEntryID,
+		DistributionID: reserve.DistributionID,
+		Month:          reserve.Month,
+		Amount:         actualAmount,
+		EntryType:      AllocationCommit,
+		CreatedAt:      s.clock.Now(),
+	}
+	if err := s.post(commit); err != nil {
+		return err
+	}
+
+	if unused := reserve.Amount - actualAmount; unused > 0 {
+		reversal := AllocationEntry{
+			ID:             reserveEntryID + "|reserve_reversal",
+			ParentID:       reserveEntryID,
+			DistributionID: reserve.DistributionID,
+			Month:          reserve.Month,
+			Amount:         unused,
+			EntryType:      AllocationReserveReversal,
+			CreatedAt:      s.clock.Now(),
+		}
+		if err := s.post(reversal); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Reverse releases a reservation in full, posting an
+// AllocationReserveReversal for the entire reserved amount.
+func (s *Service) Reverse(reserveEntryID string) error {
+	reserve, ok := s.get(reserveEntryID)
+	if !ok {
+		return fmt.Errorf("allocation: no reserve entry %s", reserveEntryID)
+	}
+	if reserve.EntryType != AllocationReserve {
+		return fmt.Errorf("allocation: entry %s is not a reservation", reserveEntryID)
+	}
+
+	reversal := AllocationEntry{
+		ID:             reserveEntryID + "|reverse",
+		ParentID:       reserveEntryID,
+		DistributionID: reserve.DistributionID,
+		Month:          reserve.Month,
+		Amount:         reserve.Amount,
+		EntryType:      AllocationReserveReversal,
+		CreatedAt:      s.clock.Now(),
+	}
+	return s.post(reversal)
+}
+
+// Project sums all posted entries for distributionID/month into reserved,
+// committed, and available (budgetForMonth minus reserved and committed).
+func (s *Service) Project(distributionID, month string, budgetForMonth float64) PeriodAllocation {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var p PeriodAllocation
+	for _, e := range s.entries {
+		if e.DistributionID != distributionID || e.Month != month {
+			continue
+		}
+		switch e.EntryType {
+		case AllocationReserve:
+			p.Reserved += e.Amount
+		case AllocationCommit:
+			// The committed portion leaves the reserved bucket and becomes
+			// actualized spend.
+			p.Committed += e.Amount
+			p.Reserved -= e.Amount
+		case AllocationReserveReversal:
+			p.Reserved -= e.Amount
+		}
+	}
+
+	p.Available = budgetForMonth - p.Reserved - p.Committed
+	return p
+}
+
+func (s *Service) post(entry AllocationEntry) error {
+	if entry.ID == "" {
+		return fmt.Errorf("allocation: entry ID is required")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := entry.dedupeKey()
+	if _, exists := s.posted[key]; exists {
+		return nil
+	}
+	s.posted[key] = struct{}{}
+	s.entries[entry.ID] = entry
+	return nil
+}
+
+func (s *Service) get(id string) (AllocationEntry, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, ok := s.entries[id]
+	return e, ok
+}
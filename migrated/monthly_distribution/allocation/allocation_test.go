@@ -0,0 +1,120 @@
+package allocation
+
+import (
+	"testing"
+	"time"
+
+	"github.com/GughanS/erpnext-ast-analyzer/clock"
+)
+
+func TestReserveThenProject(t *testing.T) {
+	svc := NewService()
+
+	if _, err := svc.Reserve("DIST-1", "January", 40.0); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	p := svc.Project("DIST-1", "January", 100.0)
+	if p.Reserved != 40.0 {
+		t.Errorf("expected Reserved 40.0, got %f", p.Reserved)
+	}
+	if p.Available != 60.0 {
+		t.Errorf("expected Available 60.0, got %f", p.Available)
+	}
+}
+
+func TestReserveIsIdempotent(t *testing.T) {
+	svc := NewService()
+
+	id1, err := svc.Reserve("DIST-1", "January", 40.0)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	id2, err := svc.Reserve("DIST-1", "January", 40.0)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if id1 != id2 {
+		t.Errorf("expected retried Reserve to return the same entry ID, got %s and %s", id1, id2)
+	}
+
+	p := svc.Project("DIST-1", "January", 100.0)
+	if p.Reserved != 40.0 {
+		t.Errorf("expected retried Reserve not to double-post, Reserved = %f", p.Reserved)
+	}
+}
+
+func TestCommitPostsReverseReversalForUnusedPortion(t *testing.T) {
+	svc := NewService()
+
+	id, _ := svc.Reserve("DIST-1", "January", 40.0)
+	if err := svc.Commit(id, 25.0); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	p := svc.Project("DIST-1", "January", 100.0)
+	if p.Committed != 25.0 {
+		t.Errorf("expected Committed 25.0, got %f", p.Committed)
+	}
+	if p.Reserved != 0 {
+		t.Errorf("expected Reserved to be fully resolved (0) after commit, got %f", p.Reserved)
+	}
+	if p.Available != 75.0 {
+		t.Errorf("expected Available 75.0, got %f", p.Available)
+	}
+}
+
+func TestReverseReleasesFullReservation(t *testing.T) {
+	svc := NewService()
+
+	id, _ := svc.Reserve("DIST-1", "January", 40.0)
+	if err := svc.Reverse(id); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	p := svc.Project("DIST-1", "January", 100.0)
+	if p.Reserved != 0 {
+		t.Errorf("expected Reserved 0 after reversal, got %f", p.Reserved)
+	}
+	if p.Available != 100.0 {
+		t.Errorf("expected Available 100.0, got %f", p.Available)
+	}
+}
+
+func TestCommitUnknownReserveEntryFails(t *testing.T) {
+	svc := NewService()
+	if err := svc.Commit("does-not-exist", 10.0); err == nil {
+		t.Fatal("expected error for unknown reserve entry")
+	}
+}
+
+func TestNewServiceWithClockStampsEntriesFromTheClock(t *testing.T) {
+	frozen := time.Date(2026, 1, 15, 0, 0, 0, 0, time.UTC)
+	fc := clock.NewFakeClock(frozen)
+	svc := NewServiceWithClock(fc)
+
+	id, err := svc.Reserve("DIST-1", "January", 40.0)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	entry, ok := svc.get(id)
+	if !ok {
+		t.Fatalf("expected entry %s to exist", id)
+	}
+	if !entry.CreatedAt.Equal(frozen) {
+		t.Errorf("expected CreatedAt %v, got %v", frozen, entry.CreatedAt)
+	}
+
+	fc.Advance(time.Hour)
+	if err := svc.Commit(id, 25.0); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	commit, ok := svc.get(id + "|commit")
+	if !ok {
+		t.Fatalf("expected commit entry to exist")
+	}
+	if !commit.CreatedAt.Equal(frozen.Add(time.Hour)) {
+		t.Errorf("expected commit CreatedAt %v, got %v", frozen.Add(time.Hour), commit.CreatedAt)
+	}
+}
@@ -1,10 +1,21 @@
 package main
 
 import (
-	"errors"
 	"fmt"
+	"math"
+
+	"github.com/GughanS/erpnext-ast-analyzer/clock"
+	"github.com/GughanS/erpnext-ast-analyzer/domainerror"
+	"github.com/GughanS/erpnext-ast-analyzer/migrated/monthly_distribution/allocation"
 )
 
+// defaultClock resolves "the current month" for GetCurrentPercentage. It
+// mirrors migrated/bin's defaultClock: a package var rather than a struct
+// field, since MonthlyDistribution is built from plain struct literals
+// throughout this package and its tests. Tests assign a clock.FakeClock
+// directly to pin "now" and assert exact values.
+var defaultClock clock.Clock = clock.RealClock{}
+
 type MonthlyDistribution struct {
 	DistributionID string
 	FiscalYear     *string
@@ -32,6 +43,38 @@ var addMonths = func(date string, months int) string {
 	return ""
 }
 
+// DistributionCalculator is the math a MonthlyDistribution leans on but
+// doesn't own: parsing a percentage string (Flt), shifting a month name
+// forward (AddMonths), and projecting how much of a month's budget is
+// reserved/committed/available (Project, backed by the allocation
+// package's reserve/commit/reverse ledger). Validate and
+// GetPeriodwiseDistributionData take this interface instead of a concrete
+// *allocation.Service so they can be exercised against a mock.
+type DistributionCalculator interface {
+	Flt(val string) float64
+	AddMonths(date string, months int) string
+	Project(distributionID, month string, budgetForMonth float64) allocation.PeriodAllocation
+}
+
+// serviceCalculator is the production DistributionCalculator: flt/addMonths
+// for the scalar math, svc for the ledger projection.
+type serviceCalculator struct {
+	svc *allocation.Service
+}
+
+// NewDistributionCalculator wraps svc as a DistributionCalculator.
+func NewDistributionCalculator(svc *allocation.Service) DistributionCalculator {
+	return &serviceCalculator{svc: svc}
+}
+
+func (c *serviceCalculator) Flt(val string) float64 { return flt(val) }
+
+func (c *serviceCalculator) AddMonths(date string, months int) string { return addMonths(date, months) }
+
+func (c *serviceCalculator) Project(distributionID, month string, budgetForMonth float64) allocation.PeriodAllocation {
+	return c.svc.Project(distributionID, month, budgetForMonth)
+}
+
 func (md *MonthlyDistribution) GetMonths() {
 	monthList := []string{
 		"January",
@@ -49,8 +92,9 @@ func (md *MonthlyDistribution) GetMonths() {
 	}
 	idx := 1
 	for _, m := range monthList {
+		month := m
 		mnth := MonthlyDistributionPercentage{}
-		mnth.Month = &m
+		mnth.Month = &month
 		allocation := 100.0 / 12
 		mnth.PercentageAllocation = &allocation
 		mnth.Idx = idx
@@ -59,43 +103,89 @@ func (md *MonthlyDistribution) GetMonths() {
 	}
 }
 
-func (md *MonthlyDistribution) Validate() error {
+// Validate checks that the month percentages sum to 100%, then, given the
+// reserve/commit lifecycle (see the allocation package), that no month's
+// committed+reserved total exceeds that month's PercentageAllocation share
+// of budget.
+func (md *MonthlyDistribution) Validate(calc DistributionCalculator, budget float64) error {
 	total := 0.0
 	for _, d := range md.Percentages {
 		total += *d.PercentageAllocation
 	}
 
-	if flt(fmt.Sprintf("%.2f", total)) != 100.0 {
-		return errors.New(fmt.Sprintf("Percentage Allocation should be equal to 100%% (%s%%)", fmt.Sprintf("%.2f", total)))
+	if calc.Flt(fmt.Sprintf("%.2f", total)) != 100.0 {
+		return &domainerror.ValidationError{
+			Message: fmt.Sprintf("Percentage Allocation should be equal to 100%% (%s%%)", fmt.Sprintf("%.2f", total)),
+		}
 	}
+
+	for _, d := range md.Percentages {
+		monthBudget := budget * (*d.PercentageAllocation) / 100.0
+		projection := calc.Project(md.DistributionID, *d.Month, monthBudget)
+		if projection.Available < 0 {
+			return &domainerror.ConflictError{
+				Message: fmt.Sprintf("month %s: committed+reserved exceeds its %.2f%% allocation of the budget", *d.Month, *d.PercentageAllocation),
+			}
+		}
+	}
+
 	return nil
 }
 
-func GetPeriodwiseDistributionData(distributionID string, periodList []Period, periodicity string) map[string]float64 {
-	doc := MonthlyDistribution{} // Assume we fetch the document here
-
+// GetPeriodwiseDistributionData projects, for each period, how much of the
+// distribution's budget is reserved, committed, and still available -- a
+// sum over the AllocationEntry rows posted to calc, rather than a pure
+// percentage calculation. doc supplies the month percentages monthBudget is
+// computed from; calling it with a *MonthlyDistribution whose Percentages
+// is empty makes every monthBudget 0, which in turn makes Available come
+// back negative as soon as anything is reserved or committed.
+func GetPeriodwiseDistributionData(doc *MonthlyDistribution, periodList []Period, periodicity string, budget float64, calc DistributionCalculator) map[string]allocation.PeriodAllocation {
 	monthsToAdd := map[string]int{
-		"Yearly":    12,
+		"Yearly":      12,
 		"Half-Yearly": 6,
-		"Quarterly": 3,
-		"Monthly":   1,
+		"Quarterly":   3,
+		"Monthly":     1,
 	}[periodicity]
 
-	periodDict := make(map[string]float64)
+	periodDict := make(map[string]allocation.PeriodAllocation)
 
 	for _, d := range periodList {
-		periodDict[d.Key] = GetPercentage(&doc, d.FromDate, monthsToAdd)
+		months := []string{d.FromDate}
+		for r := 1; r < monthsToAdd; r++ {
+			months = append(months, calc.AddMonths(d.FromDate, r))
+		}
+
+		var agg allocation.PeriodAllocation
+		for _, month := range months {
+			monthBudget := budget * percentageForMonth(doc, month) / 100.0
+			p := calc.Project(doc.DistributionID, month, monthBudget)
+			agg.Reserved += p.Reserved
+			agg.Committed += p.Committed
+			agg.Available += p.Available
+		}
+		periodDict[d.Key] = agg
 	}
 
 	return periodDict
 }
 
-func GetPercentage(doc *MonthlyDistribution, startDate string, period int) float64 {
+// percentageForMonth looks up the PercentageAllocation configured for a
+// single month, returning 0 if the month isn't in doc.Percentages.
+func percentageForMonth(doc *MonthlyDistribution, month string) float64 {
+	for _, d := range doc.Percentages {
+		if d.Month != nil && *d.Month == month {
+			return *d.PercentageAllocation
+		}
+	}
+	return 0
+}
+
+func GetPercentage(doc *MonthlyDistribution, calc DistributionCalculator, startDate string, period int) float64 {
 	percentage := 0.0
 	months := []string{startDate} // Assume startDate is formatted to month name
 
 	for r := 1; r < period; r++ {
-		months = append(months, addMonths(startDate, r))
+		months = append(months, calc.AddMonths(startDate, r))
 	}
 
 	for _, d := range doc.Percentages {
@@ -108,10 +198,23 @@ func GetPercentage(doc *MonthlyDistribution, startDate string, period int) float
 		}
 	}
 
-	return percentage
+	// Summing float64 PercentageAllocation shares can land a hair off a
+	// whole number (e.g. 99.99999999999999 instead of 100); round to avoid
+	// that drift leaking into callers. (flt is an unimplemented stub here,
+	// not a real parser, so round directly rather than through it.)
+	return math.Round(percentage*100) / 100
+}
+
+// GetCurrentPercentage is GetPercentage anchored to the current month
+// (per defaultClock) rather than an explicit startDate, for callers that
+// want "how much of the distribution is allocated starting this month"
+// without computing the month name themselves. Swap defaultClock for a
+// clock.FakeClock in tests to pin "now" and assert exact values.
+func GetCurrentPercentage(doc *MonthlyDistribution, calc DistributionCalculator, period int) float64 {
+	return GetPercentage(doc, calc, defaultClock.Now().Month().String(), period)
 }
 
 type Period struct {
 	Key      string
 	FromDate string
-}
\ No newline at end of file
+}
@@ -1,23 +1,18 @@
 package main
 
 import (
+	"errors"
 	"testing"
+	"time"
+
+	"github.com/GughanS/erpnext-ast-analyzer/clock"
+	"github.com/GughanS/erpnext-ast-analyzer/domainerror"
+	"github.com/GughanS/erpnext-ast-analyzer/migrated/monthly_distribution/allocation"
+	mocks "github.com/GughanS/erpnext-ast-analyzer/migrated/monthly_distribution/testing"
+	"github.com/stretchr/testify/mock"
 )
 
 func TestGetMonths(t *testing.T) {
-	// Save originals
-	origFlt := flt
-
-	// Mock by REASSIGNING the function variable (not calling it)
-	flt = func(val string) float64 {
-		return 100.0
-	}
-
-	// Restore
-	defer func() {
-		flt = origFlt
-	}()
-
 	md := &MonthlyDistribution{}
 	md.GetMonths()
 
@@ -36,88 +31,159 @@ func TestGetMonths(t *testing.T) {
 }
 
 func TestValidate(t *testing.T) {
-	// Save originals
-	origFlt := flt
+	md := &MonthlyDistribution{DistributionID: "DIST-1"}
+	md.GetMonths()
+
+	validCalc := new(mocks.MockDistributionCalculator)
+	validCalc.On("Flt", mock.Anything).Return(100.0)
+	validCalc.On("Project", mock.Anything, mock.Anything, mock.Anything).Return(allocation.PeriodAllocation{Available: 100})
 
-	// Mock by REASSIGNING the function variable (not calling it)
-	flt = func(val string) float64 {
-		return 100.0
+	if err := md.Validate(validCalc, 1200.0); err != nil {
+		t.Errorf("Expected no error, got %v", err)
 	}
+	validCalc.AssertExpectations(t)
 
-	// Restore
-	defer func() {
-		flt = origFlt
-	}()
+	md.Percentages[0].PercentageAllocation = new(float64)
 
-	md := &MonthlyDistribution{}
-	md.GetMonths()
+	overBudgetCalc := new(mocks.MockDistributionCalculator)
+	overBudgetCalc.On("Flt", mock.Anything).Return(100.0)
+	overBudgetCalc.On("Project", mock.Anything, mock.Anything, mock.Anything).Return(allocation.PeriodAllocation{Available: -1})
 
-	// Test valid allocation
-	if err := md.Validate(); err != nil {
-		t.Errorf("Expected no error, got %v", err)
+	err := md.Validate(overBudgetCalc, 1200.0)
+	if err == nil {
+		t.Error("Expected error, got none")
 	}
+	var conflictErr *domainerror.ConflictError
+	if !errors.As(err, &conflictErr) {
+		t.Errorf("expected a *domainerror.ConflictError, got %T", err)
+	}
+}
 
-	// Test invalid allocation
+func TestValidateRejectsBadPercentageTotalAsValidationError(t *testing.T) {
+	md := &MonthlyDistribution{DistributionID: "DIST-1"}
+	md.GetMonths()
 	md.Percentages[0].PercentageAllocation = new(float64)
-	if err := md.Validate(); err == nil {
-		t.Error("Expected error, got none")
+
+	calc := new(mocks.MockDistributionCalculator)
+	calc.On("Flt", mock.Anything).Return(91.67)
+
+	err := md.Validate(calc, 1200.0)
+	var validationErr *domainerror.ValidationError
+	if !errors.As(err, &validationErr) {
+		t.Errorf("expected a *domainerror.ValidationError, got %T", err)
 	}
 }
 
-func TestGetPercentage(t *testing.T) {
-	// Save originals
-	origAddMonths := addMonths
+func TestValidateRejectsOverReservedMonth(t *testing.T) {
+	origFlt := flt
+	flt = func(val string) float64 { return 100.0 }
+	defer func() { flt = origFlt }()
+
+	january := "January"
+	allocation100 := 100.0
+	md := &MonthlyDistribution{
+		DistributionID: "DIST-2",
+		Percentages: []MonthlyDistributionPercentage{
+			{Month: &january, PercentageAllocation: &allocation100},
+		},
+	}
 
-	// Mock by REASSIGNING the function variable (not calling it)
-	addMonths = func(date string, months int) string {
-		return "February" // Mocking to always return February for simplicity
+	svc := allocation.NewService()
+	calc := NewDistributionCalculator(svc)
+
+	// January's share of a 1200 budget is 100% of it here; reserve more than that.
+	if _, err := svc.Reserve("DIST-2", "January", 1500.0); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	err := md.Validate(calc, 1200.0)
+	if err == nil {
+		t.Error("expected error for a month reserved beyond its allocation, got none")
 	}
+	var conflictErr *domainerror.ConflictError
+	if !errors.As(err, &conflictErr) {
+		t.Errorf("expected a *domainerror.ConflictError, got %T", err)
+	}
+}
 
-	// Restore
-	defer func() {
-		addMonths = origAddMonths
-	}()
+func TestGetPercentage(t *testing.T) {
+	calc := new(mocks.MockDistributionCalculator)
+	calc.On("AddMonths", mock.Anything, mock.Anything).Return("February")
 
 	md := &MonthlyDistribution{}
 	md.GetMonths()
 
-	percentage := GetPercentage(md, "January", 12)
+	percentage := GetPercentage(md, calc, "January", 12)
 
 	if percentage != 100.0 {
 		t.Errorf("Expected percentage 100.0, got %f", percentage)
 	}
+	calc.AssertExpectations(t)
 }
 
-func TestGetPeriodwiseDistributionData(t *testing.T) {
-	// Save originals
-	origGetPercentage := GetPercentage
+func TestGetCurrentPercentageUsesTheFrozenClock(t *testing.T) {
+	origClock := defaultClock
+	defaultClock = clock.NewFakeClock(time.Date(2026, 7, 15, 0, 0, 0, 0, time.UTC))
+	defer func() { defaultClock = origClock }()
 
-	// Mock by REASSIGNING the function variable (not calling it)
-	GetPercentage = func(doc *MonthlyDistribution, startDate string, period int) float64 {
-		return 50.0 // Mocking to return a fixed percentage
-	}
+	calc := new(mocks.MockDistributionCalculator)
+	calc.On("AddMonths", "July", mock.Anything).Return("August")
+
+	md := &MonthlyDistribution{}
+	md.GetMonths()
+
+	percentage := GetCurrentPercentage(md, calc, 12)
 
-	// Restore
-	defer func() {
-		GetPercentage = origGetPercentage
-	}()
+	if percentage != 100.0 {
+		t.Errorf("Expected percentage 100.0, got %f", percentage)
+	}
+	calc.AssertExpectations(t)
+}
 
+func TestGetPeriodwiseDistributionData(t *testing.T) {
 	periodList := []Period{
 		{Key: "Period1", FromDate: "January"},
 		{Key: "Period2", FromDate: "February"},
 	}
 
-	result := GetPeriodwiseDistributionData("distributionID", periodList, "Monthly")
+	january := "January"
+	february := "February"
+	allocation50 := 50.0
+	doc := &MonthlyDistribution{
+		DistributionID: "distributionID",
+		Percentages: []MonthlyDistributionPercentage{
+			{Month: &january, PercentageAllocation: &allocation50},
+			{Month: &february, PercentageAllocation: &allocation50},
+		},
+	}
+
+	svc := allocation.NewService()
+	calc := NewDistributionCalculator(svc)
+	if _, err := svc.Reserve("distributionID", "January", 30.0); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	result := GetPeriodwiseDistributionData(doc, periodList, "Monthly", 1200.0, calc)
 
 	if len(result) != 2 {
 		t.Errorf("Expected 2 periods, got %d", len(result))
 	}
 
-	if result["Period1"] != 50.0 {
-		t.Errorf("Expected percentage for Period1 to be 50.0, got %f", result["Period1"])
+	if result["Period1"].Reserved != 30.0 {
+		t.Errorf("Expected Period1 Reserved to be 30.0, got %f", result["Period1"].Reserved)
+	}
+	if result["Period2"].Reserved != 0 {
+		t.Errorf("Expected Period2 Reserved to be 0, got %f", result["Period2"].Reserved)
 	}
 
-	if result["Period2"] != 50.0 {
-		t.Errorf("Expected percentage for Period2 to be 50.0, got %f", result["Period2"])
+	// January's share of the 1200 budget is 50% (600); 30 of that is
+	// reserved, so 570 should remain available. A doc with empty
+	// Percentages would make this share 0 and Available negative the
+	// instant anything is reserved.
+	if result["Period1"].Available != 570.0 {
+		t.Errorf("Expected Period1 Available to be 570.0, got %f", result["Period1"].Available)
+	}
+	if result["Period2"].Available != 600.0 {
+		t.Errorf("Expected Period2 Available to be 600.0, got %f", result["Period2"].Available)
 	}
-}
\ No newline at end of file
+}
@@ -0,0 +1,151 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"regexp"
+)
+
+// identifierPattern restricts the doctype/fieldname strings that get
+// interpolated into table/column position in a query. Values themselves are
+// always passed as bind parameters; doctype and fieldname can't be, since
+// database/sql has no placeholder syntax for identifiers, so they're
+// validated against this allowlist instead of being trusted as-is.
+var identifierPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_ ]*$`)
+
+func validateIdentifier(kind, s string) error {
+	if !identifierPattern.MatchString(s) {
+		return fmt.Errorf("storage: invalid %s %q", kind, s)
+	}
+	return nil
+}
+
+// PostgresStore is the database/sql-backed Store implementation. It expects
+// a *sql.DB already opened against the "pq" (or equivalent) driver; it only
+// issues parameterized queries, never building SQL out of caller-supplied
+// values.
+type PostgresStore struct {
+	db *sql.DB
+}
+
+// NewPostgresStore wraps an open *sql.DB as a Store.
+func NewPostgresStore(db *sql.DB) *PostgresStore {
+	return &PostgresStore{db: db}
+}
+
+func (s *PostgresStore) GetValueStr(ctx context.Context, doctype, name, fieldname string) (string, error) {
+	if err := validateIdentifier("doctype", doctype); err != nil {
+		return "", err
+	}
+	if err := validateIdentifier("fieldname", fieldname); err != nil {
+		return "", err
+	}
+
+	query := fmt.Sprintf(`SELECT %s FROM "tab%s" WHERE name = $1`, fieldname, doctype)
+	var value sql.NullString
+	if err := s.db.QueryRowContext(ctx, query, name).Scan(&value); err != nil {
+		if err == sql.ErrNoRows {
+			return "", nil
+		}
+		return "", fmt.Errorf("storage: get %s.%s for %q: %w", doctype, fieldname, name, err)
+	}
+	return value.String, nil
+}
+
+func (s *PostgresStore) SetValue(ctx context.Context, doctype, name, fieldname, value string) error {
+	if err := validateIdentifier("doctype", doctype); err != nil {
+		return err
+	}
+	if err := validateIdentifier("fieldname", fieldname); err != nil {
+		return err
+	}
+
+	query := fmt.Sprintf(`UPDATE "tab%s" SET %s = $1 WHERE name = $2`, doctype, fieldname)
+	if _, err := s.db.ExecContext(ctx, query, value, name); err != nil {
+		return fmt.Errorf("storage: set %s.%s for %q: %w", doctype, fieldname, name, err)
+	}
+	return nil
+}
+
+func (s *PostgresStore) GetBinDetails(ctx context.Context, binName string) (map[string]string, error) {
+	const query = `
+		SELECT actual_qty, ordered_qty, reserved_qty, indented_qty, planned_qty,
+		       reserved_qty_for_production, reserved_qty_for_sub_contract
+		FROM "tabBin"
+		WHERE name = $1
+	`
+	row := s.db.QueryRowContext(ctx, query, binName)
+
+	var actualQty, orderedQty, reservedQty, indentedQty, plannedQty, reservedProd, reservedSub sql.NullString
+	if err := row.Scan(&actualQty, &orderedQty, &reservedQty, &indentedQty, &plannedQty, &reservedProd, &reservedSub); err != nil {
+		if err == sql.ErrNoRows {
+			return map[string]string{}, nil
+		}
+		return nil, fmt.Errorf("storage: get bin details for %q: %w", binName, err)
+	}
+
+	return map[string]string{
+		"actual_qty":                   actualQty.String,
+		"ordered_qty":                  orderedQty.String,
+		"reserved_qty":                 reservedQty.String,
+		"indented_qty":                 indentedQty.String,
+		"planned_qty":                  plannedQty.String,
+		"reserved_qty_for_production":  reservedProd.String,
+		"reserved_qty_for_sub_contract": reservedSub.String,
+	}, nil
+}
+
+func (s *PostgresStore) GetActualQty(ctx context.Context, itemCode, warehouse string) (float64, error) {
+	const query = `SELECT COALESCE(actual_qty, 0) FROM "tabBin" WHERE item_code = $1 AND warehouse = $2`
+	var qty float64
+	if err := s.db.QueryRowContext(ctx, query, itemCode, warehouse).Scan(&qty); err != nil {
+		if err == sql.ErrNoRows {
+			return 0, nil
+		}
+		return 0, fmt.Errorf("storage: get actual qty for %s/%s: %w", itemCode, warehouse, err)
+	}
+	return qty, nil
+}
+
+func (s *PostgresStore) GetReservedQtyForProductionPlan(ctx context.Context, productionPlan, item string) (float64, error) {
+	const query = `
+		SELECT COALESCE(SUM(reserved_qty_for_production_plan), 0)
+		FROM "tabProduction Plan Item"
+		WHERE parent = $1 AND item_code = $2
+	`
+	var qty float64
+	if err := s.db.QueryRowContext(ctx, query, productionPlan, item).Scan(&qty); err != nil {
+		if err == sql.ErrNoRows {
+			return 0, nil
+		}
+		return 0, fmt.Errorf("storage: get reserved qty for production plan %s/%s: %w", productionPlan, item, err)
+	}
+	return qty, nil
+}
+
+func (s *PostgresStore) BeginTx(ctx context.Context) (*sql.Tx, error) {
+	return s.db.BeginTx(ctx, nil)
+}
+
+func (s *PostgresStore) InsertGLEntry(ctx context.Context, tx *sql.Tx, entry GLEntry) error {
+	const query = `
+		INSERT INTO "tabGL Entry" (voucher_type, voucher_no, account, debit, credit, posting_date)
+		VALUES ($1, $2, $3, $4, $5, $6)
+	`
+	if _, err := tx.ExecContext(ctx, query, entry.VoucherType, entry.VoucherNo, entry.Account, entry.DebitAmount, entry.CreditAmount, entry.PostingDate); err != nil {
+		return fmt.Errorf("storage: insert GL entry for %s %s: %w", entry.VoucherType, entry.VoucherNo, err)
+	}
+	return nil
+}
+
+func (s *PostgresStore) InsertStockLedgerEntry(ctx context.Context, tx *sql.Tx, entry StockLedgerEntry) error {
+	const query = `
+		INSERT INTO "tabStock Ledger Entry" (item_code, warehouse, voucher_no, qty, posting_date)
+		VALUES ($1, $2, $3, $4, $5)
+	`
+	if _, err := tx.ExecContext(ctx, query, entry.ItemCode, entry.Warehouse, entry.VoucherNo, entry.Qty, entry.PostingDate); err != nil {
+		return fmt.Errorf("storage: insert stock ledger entry for %s/%s: %w", entry.ItemCode, entry.Warehouse, err)
+	}
+	return nil
+}
@@ -0,0 +1,21 @@
+package storage
+
+import "testing"
+
+func TestValidateIdentifierAcceptsDoctypeAndFieldNames(t *testing.T) {
+	cases := []string{"Bin", "Sales Invoice", "actual_qty", "reserved_qty_for_production_plan"}
+	for _, c := range cases {
+		if err := validateIdentifier("doctype", c); err != nil {
+			t.Errorf("expected %q to be a valid identifier, got %v", c, err)
+		}
+	}
+}
+
+func TestValidateIdentifierRejectsInjectionAttempts(t *testing.T) {
+	cases := []string{"", "Bin\"; DROP TABLE \"tabBin\"; --", "actual_qty = 0 OR 1=1", "a'b"}
+	for _, c := range cases {
+		if err := validateIdentifier("fieldname", c); err == nil {
+			t.Errorf("expected %q to be rejected as an invalid identifier", c)
+		}
+	}
+}
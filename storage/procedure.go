@@ -0,0 +1,135 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+// Param is a single named input argument to a stored procedure call made
+// through Store.CallProcedure.
+type Param struct {
+	Name  string
+	Value any
+}
+
+// OutParam is a single OUT/INOUT argument a stored procedure call writes
+// its result into. Dest must be a pointer. On Postgres it is scanned out of
+// the row CALL returns; on SQL Server it is bound to the driver as
+// sql.Out{Dest: Dest}.
+type OutParam struct {
+	Name string
+	Dest any
+}
+
+// dialect identifies which stored-procedure calling convention
+// CallProcedure should speak: Postgres's CALL (OUT params come back as
+// columns of the returned row) or SQL Server's EXEC (OUT params are bound
+// via sql.Out).
+type dialect int
+
+const (
+	dialectPostgres dialect = iota
+	dialectMSSQL
+)
+
+// detectDialect infers the calling convention from the driver db was opened
+// with. mssql drivers (e.g. go-mssqldb, denisenkom/go-mssqldb) register
+// under a type name containing "mssql"; anything else is assumed to be
+// Postgres, this store's primary target.
+func (s *PostgresStore) detectDialect() dialect {
+	if strings.Contains(strings.ToLower(fmt.Sprintf("%T", s.db.Driver())), "mssql") {
+		return dialectMSSQL
+	}
+	return dialectPostgres
+}
+
+// postgresCallQuery builds the `CALL name($1, $2, ...)` statement and bind
+// args for name with in as its input arguments.
+func postgresCallQuery(name string, in []Param) (string, []any) {
+	placeholders := make([]string, len(in))
+	args := make([]any, len(in))
+	for i, p := range in {
+		placeholders[i] = fmt.Sprintf("$%d", i+1)
+		args[i] = p.Value
+	}
+	return fmt.Sprintf("CALL %s(%s)", name, strings.Join(placeholders, ", ")), args
+}
+
+// mssqlExecQuery builds the `EXEC name @in1 = @in1, ..., @out1 = @out1 OUTPUT, ...`
+// statement and sql.Named/sql.Out args for name with in as its input
+// arguments and out as its OUTPUT arguments.
+func mssqlExecQuery(name string, in []Param, out []OutParam) (string, []any) {
+	params := make([]string, 0, len(in)+len(out))
+	args := make([]any, 0, len(in)+len(out))
+	for _, p := range in {
+		params = append(params, fmt.Sprintf("@%s = @%s", p.Name, p.Name))
+		args = append(args, sql.Named(p.Name, p.Value))
+	}
+	for _, o := range out {
+		params = append(params, fmt.Sprintf("@%s = @%s OUTPUT", o.Name, o.Name))
+		args = append(args, sql.Named(o.Name, sql.Out{Dest: o.Dest}))
+	}
+	return fmt.Sprintf("EXEC %s %s", name, strings.Join(params, ", ")), args
+}
+
+// CallProcedure invokes the stored procedure name, binding in as its input
+// arguments and writing any OUT/INOUT results into out's Dest pointers.
+// GeneralLedgerService.MakeGLEntries uses this to call post_gl_entries and
+// read back the generated voucher number and running balance.
+func (s *PostgresStore) CallProcedure(ctx context.Context, name string, in []Param, out []OutParam) error {
+	if err := validateIdentifier("procedure", name); err != nil {
+		return err
+	}
+
+	switch s.detectDialect() {
+	case dialectMSSQL:
+		return s.callProcedureMSSQL(ctx, name, in, out)
+	default:
+		return s.callProcedurePostgres(ctx, name, in, out)
+	}
+}
+
+// callProcedurePostgres calls name via `CALL name(...)`. A Postgres
+// procedure's OUT/INOUT parameters come back as columns of the single row
+// the CALL returns, so out's Dest pointers are read with a plain Scan.
+func (s *PostgresStore) callProcedurePostgres(ctx context.Context, name string, in []Param, out []OutParam) error {
+	query, args := postgresCallQuery(name, in)
+
+	if len(out) == 0 {
+		if _, err := s.db.ExecContext(ctx, query, args...); err != nil {
+			return fmt.Errorf("storage: call procedure %s: %w", name, err)
+		}
+		return nil
+	}
+
+	dests := make([]any, len(out))
+	for i, o := range out {
+		dests[i] = o.Dest
+	}
+	if err := s.db.QueryRowContext(ctx, query, args...).Scan(dests...); err != nil {
+		return fmt.Errorf("storage: call procedure %s: %w", name, err)
+	}
+	return nil
+}
+
+// callProcedureMSSQL calls name via `EXEC name ...`. A SQL Server procedure
+// can both return result rows and set OUTPUT parameters; the driver only
+// populates sql.Out destinations once the result set has been fully read,
+// so rows are drained and closed before out's Dest pointers are read.
+func (s *PostgresStore) callProcedureMSSQL(ctx context.Context, name string, in []Param, out []OutParam) error {
+	query, args := mssqlExecQuery(name, in, out)
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("storage: call procedure %s: %w", name, err)
+	}
+	for rows.Next() {
+	}
+	if err := rows.Err(); err != nil {
+		rows.Close()
+		return fmt.Errorf("storage: call procedure %s: %w", name, err)
+	}
+	return rows.Close()
+}
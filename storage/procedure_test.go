@@ -0,0 +1,184 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"testing"
+)
+
+// fakeDriver and fakeMSSQLDriver exist only so detectDialect has something
+// to type-switch on; neither driver ever actually opens a connection.
+type fakeDriver struct{}
+
+func (fakeDriver) Open(name string) (driver.Conn, error) {
+	return nil, errors.New("fakeDriver: not implemented")
+}
+
+type fakeMSSQLDriver struct{ fakeDriver }
+
+func init() {
+	sql.Register("storagetest_fakepg", fakeDriver{})
+	sql.Register("storagetest_fakemssql", fakeMSSQLDriver{})
+}
+
+func TestPostgresCallQueryBuildsPositionalPlaceholders(t *testing.T) {
+	query, args := postgresCallQuery("post_gl_entries", []Param{
+		{Name: "voucher_no", Value: "SI-1"},
+		{Name: "debit", Value: 100.0},
+	})
+
+	const want = "CALL post_gl_entries($1, $2)"
+	if query != want {
+		t.Errorf("expected query %q, got %q", want, query)
+	}
+	if len(args) != 2 || args[0] != "SI-1" || args[1] != 100.0 {
+		t.Errorf("expected args [SI-1 100], got %v", args)
+	}
+}
+
+func TestMSSQLExecQueryBindsInputsAndOutputsAsNamedParams(t *testing.T) {
+	var voucherNo string
+	query, args := mssqlExecQuery("post_gl_entries", []Param{
+		{Name: "debit", Value: 100.0},
+	}, []OutParam{
+		{Name: "generated_voucher_no", Dest: &voucherNo},
+	})
+
+	const want = "EXEC post_gl_entries @debit = @debit, @generated_voucher_no = @generated_voucher_no OUTPUT"
+	if query != want {
+		t.Errorf("expected query %q, got %q", want, query)
+	}
+	if len(args) != 2 {
+		t.Fatalf("expected 2 args, got %d", len(args))
+	}
+	if _, ok := args[0].(sql.NamedArg); !ok {
+		t.Errorf("expected input arg to be a sql.NamedArg, got %T", args[0])
+	}
+	out, ok := args[1].(sql.NamedArg)
+	if !ok {
+		t.Fatalf("expected output arg to be a sql.NamedArg, got %T", args[1])
+	}
+	if _, ok := out.Value.(sql.Out); !ok {
+		t.Errorf("expected output arg's Value to be a sql.Out, got %T", out.Value)
+	}
+}
+
+func TestDetectDialectDistinguishesPostgresAndMSSQLDrivers(t *testing.T) {
+	pg, err := sql.Open("storagetest_fakepg", "")
+	if err != nil {
+		t.Fatalf("expected no error opening the fake postgres driver, got %v", err)
+	}
+	if got := (&PostgresStore{db: pg}).detectDialect(); got != dialectPostgres {
+		t.Errorf("expected dialectPostgres, got %v", got)
+	}
+
+	mssql, err := sql.Open("storagetest_fakemssql", "")
+	if err != nil {
+		t.Fatalf("expected no error opening the fake mssql driver, got %v", err)
+	}
+	if got := (&PostgresStore{db: mssql}).detectDialect(); got != dialectMSSQL {
+		t.Errorf("expected dialectMSSQL, got %v", got)
+	}
+}
+
+// outRows is a driver.Rows fake for a SQL Server procedure that both
+// returns a result row and sets an OUTPUT parameter. It only writes dest's
+// value in Close, so a test reading dest before CallProcedure returns (i.e.
+// before callProcedureMSSQL has drained and closed rows) would observe it
+// still unset -- the same hazard callProcedureMSSQL's comment describes.
+type outRows struct {
+	returned bool
+	dest     *string
+	value    string
+}
+
+func (r *outRows) Columns() []string { return []string{"generated_voucher_no"} }
+func (r *outRows) Close() error {
+	if r.dest != nil {
+		*r.dest = r.value
+	}
+	return nil
+}
+func (r *outRows) Next(dest []driver.Value) error {
+	if r.returned {
+		return io.EOF
+	}
+	r.returned = true
+	dest[0] = r.value
+	return nil
+}
+
+// outConn is a driver.Conn fake that hands back outRows from QueryContext
+// and, via CheckNamedValue, captures an OUTPUT arg's sql.Out.Dest so
+// outRows.Close can populate it -- standing in for a real mssql driver,
+// which does the same thing once the result set is fully read.
+type outConn struct{ rows *outRows }
+
+func (c *outConn) Prepare(query string) (driver.Stmt, error) {
+	return nil, errors.New("outConn: Prepare not implemented")
+}
+func (c *outConn) Close() error { return nil }
+func (c *outConn) Begin() (driver.Tx, error) {
+	return nil, errors.New("outConn: Begin not implemented")
+}
+
+func (c *outConn) CheckNamedValue(nv *driver.NamedValue) error {
+	if out, ok := nv.Value.(sql.Out); ok {
+		if dest, ok := out.Dest.(*string); ok {
+			c.rows.dest = dest
+		}
+		nv.Value = nil
+		return nil
+	}
+	nv.Value = fmt.Sprintf("%v", nv.Value)
+	return nil
+}
+
+func (c *outConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	return c.rows, nil
+}
+
+type outMSSQLDriver struct{ conn *outConn }
+
+func (d *outMSSQLDriver) Open(name string) (driver.Conn, error) { return d.conn, nil }
+
+func init() {
+	sql.Register("storagetest_fakemssql_rows", &outMSSQLDriver{conn: &outConn{rows: &outRows{value: "SI-0001"}}})
+}
+
+func TestCallProcedureMSSQLPopulatesOutputOnlyAfterRowsAreClosed(t *testing.T) {
+	db, err := sql.Open("storagetest_fakemssql_rows", "")
+	if err != nil {
+		t.Fatalf("expected no error opening the fake mssql driver, got %v", err)
+	}
+	s := &PostgresStore{db: db}
+
+	var voucherNo string
+	err = s.callProcedureMSSQL(context.Background(), "post_gl_entries", nil, []OutParam{
+		{Name: "generated_voucher_no", Dest: &voucherNo},
+	})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if voucherNo != "SI-0001" {
+		t.Errorf("expected voucherNo %q populated after rows.Close, got %q", "SI-0001", voucherNo)
+	}
+}
+
+func TestCallProcedureRejectsAnInvalidProcedureName(t *testing.T) {
+	db, err := sql.Open("storagetest_fakepg", "")
+	if err != nil {
+		t.Fatalf("expected no error opening the fake postgres driver, got %v", err)
+	}
+	s := &PostgresStore{db: db}
+
+	err = s.CallProcedure(context.Background(), "post_gl_entries; DROP TABLE \"tabGL Entry\"; --", nil, nil)
+	if err == nil {
+		t.Error("expected an error for an invalid procedure name")
+	}
+}
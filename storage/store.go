@@ -0,0 +1,58 @@
+// Package storage defines the persistence boundary shared by the Bin and
+// SalesInvoice domain logic. Store abstracts the handful of document-store
+// reads (GetValueStr, GetBinDetails, ...) and ledger writes (InsertGLEntry,
+// InsertStockLedgerEntry) that used to be package-level stub function
+// variables, so a real database can be plugged in without touching the
+// callers.
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// GLEntry is a single General Ledger posting, as inserted by
+// Store.InsertGLEntry.
+type GLEntry struct {
+	VoucherType  string
+	VoucherNo    string
+	Account      string
+	DebitAmount  float64
+	CreditAmount float64
+	PostingDate  time.Time
+}
+
+// StockLedgerEntry is a single Stock Ledger posting, as inserted by
+// Store.InsertStockLedgerEntry.
+type StockLedgerEntry struct {
+	ItemCode    string
+	Warehouse   string
+	VoucherNo   string
+	Qty         float64
+	PostingDate time.Time
+}
+
+// Store is the persistence interface consumed by the Bin and SalesInvoice
+// domain logic. GetValueStr/SetValue/GetBinDetails mirror frappe's generic
+// doctype value accessors; InsertGLEntry/InsertStockLedgerEntry are the
+// transactional writes made on invoice submission.
+type Store interface {
+	GetValueStr(ctx context.Context, doctype, name, fieldname string) (string, error)
+	SetValue(ctx context.Context, doctype, name, fieldname, value string) error
+	GetBinDetails(ctx context.Context, binName string) (map[string]string, error)
+	GetActualQty(ctx context.Context, itemCode, warehouse string) (float64, error)
+	GetReservedQtyForProductionPlan(ctx context.Context, productionPlan, item string) (float64, error)
+
+	// BeginTx starts a transaction that InsertGLEntry and
+	// InsertStockLedgerEntry can be called against, letting a caller commit
+	// or roll back both writes together.
+	BeginTx(ctx context.Context) (*sql.Tx, error)
+	InsertGLEntry(ctx context.Context, tx *sql.Tx, entry GLEntry) error
+	InsertStockLedgerEntry(ctx context.Context, tx *sql.Tx, entry StockLedgerEntry) error
+
+	// CallProcedure invokes a server-side stored procedure such as
+	// post_gl_entries, passing in as its input arguments and writing any
+	// OUT/INOUT results into out's Dest pointers.
+	CallProcedure(ctx context.Context, name string, in []Param, out []OutParam) error
+}